@@ -0,0 +1,279 @@
+//Package admin serves an HTTP API for operating
+//a running Moon without touching its tables by hand
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"moon/config"
+	"moon/indexer"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+//Server serves the admin API
+type Server struct {
+	address string
+	token   string
+	indexer *indexer.Indexer
+	pg      *bun.DB
+}
+
+//boardStatus is the status of an index of a board
+//along with the job syncing it, if it's running
+type boardStatus struct {
+	indexer.TrackerStatus
+	Paused     bool       `json:"paused"`
+	GaveUp     bool       `json:"gave_up"`
+	Failures   int        `json:"failures"`
+	LastError  string     `json:"last_error,omitempty"`
+	LastFailed *time.Time `json:"last_failed,omitempty"`
+}
+
+//NewServer constructs and returns a Server
+func NewServer(conf config.AdminConfig, ix *indexer.Indexer, pg *bun.DB) *Server {
+	return &Server{
+		address: conf.Address,
+		token:   conf.Token,
+		indexer: ix,
+		pg:      pg,
+	}
+}
+
+//ServeHTTP serves the admin API, every request needing
+//an Authorization: Bearer <token> header
+//
+//	GET  /boards                   cursor, lag and last error of every index
+//	POST /boards/{board}/sync      sync a board right away unless paused
+//	POST /boards/{board}/pause     stop syncing a board
+//	POST /boards/{board}/resume    resume syncing a paused board
+//	POST /boards/{board}/reindex   rebuild the index of a board
+//
+//	GET  /boards/{board}/dead-letters           posts of a board sinks rejected
+//	POST /boards/{board}/dead-letters/retry     retry them on the next pass
+//	POST /boards/{board}/dead-letters/discard   delete them
+//
+//Dead letter requests take an optional comma separated
+//posts query parameter to only act on some posts.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.URL.Path == "/boards" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		s.listBoards(w, r)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/boards/"), "/")
+
+	if strings.HasPrefix(r.URL.Path, "/boards/") && len(parts) >= 2 && parts[1] == "dead-letters" {
+		s.deadLetters(w, r, parts[0], parts[2:])
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, "/boards/") || len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	board, action := parts[0], parts[1]
+
+	var err error
+
+	switch action {
+	case "sync":
+		err = s.indexer.Sync(board)
+	case "pause":
+		err = s.indexer.Pause(board)
+	case "resume":
+		err = s.indexer.Resume(board)
+	case "reindex":
+		err = s.indexer.Reindex(r.Context(), board)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if errors.Is(err, indexer.ErrUnknownBoard) {
+		http.Error(w, "Unknown board", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		slog.Error("Error handling admin request", "board", board, "action", action, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Admin request handled", "board", board, "action", action)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+//deadLetters lists the dead letters of a board,
+//or retries or discards them
+func (s *Server) deadLetters(w http.ResponseWriter, r *http.Request, board string, rest []string) {
+	postNumbers, err := indexer.ParsePostNumbers(r.URL.Query().Get("posts"))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	action := "list"
+
+	if len(rest) == 1 {
+		action = rest[0]
+	} else if len(rest) > 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	method := http.MethodPost
+
+	if action == "list" {
+		method = http.MethodGet
+	}
+
+	if r.Method != method {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var result any
+
+	switch action {
+	case "list":
+		result, err = s.indexer.DeadLetters(r.Context(), board, postNumbers)
+	case "retry":
+		var n int64
+		n, err = s.indexer.RetryDeadLetters(r.Context(), board, postNumbers)
+		result = map[string]int64{"dead_letters": n}
+	case "discard":
+		var n int64
+		n, err = s.indexer.DiscardDeadLetters(r.Context(), board, postNumbers)
+		result = map[string]int64{"dead_letters": n}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if errors.Is(err, indexer.ErrUnknownBoard) {
+		http.Error(w, "Unknown board", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		slog.Error("Error handling admin request", "board", board, "action", action+" dead letters", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if action != "list" {
+		slog.Info("Admin request handled", "board", board, "action", action+" dead letters")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		slog.Error("Error writing admin response", "board", board, "action", action+" dead letters", "error", err)
+	}
+}
+
+//listBoards responds with the status of every index
+//tracker, merged with the state of the job syncing it
+func (s *Server) listBoards(w http.ResponseWriter, r *http.Request) {
+	trackers, err := indexer.Status(r.Context(), s.pg)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jobs := s.indexer.Jobs()
+	statuses := make([]boardStatus, 0, len(trackers))
+
+	for _, tracker := range trackers {
+		status := boardStatus{
+			TrackerStatus: tracker,
+			Paused:        s.indexer.Paused(tracker.Board),
+		}
+
+		for _, j := range jobs {
+			if j.Sink != tracker.Sink || j.Board != tracker.Board {
+				continue
+			}
+
+			if (tracker.Live && j.Rebuild == "") || j.Rebuild == tracker.IndexName {
+				status.GaveUp = j.GaveUp
+				status.Failures = j.Failures
+				status.LastError = j.LastError
+				status.LastFailed = j.LastFailed
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(statuses); err != nil {
+		slog.Error("Error writing admin response", "action", "list boards", "error", err)
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+
+	token := strings.TrimPrefix(header, "Bearer ")
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+//Serve serves the admin API until ctx is cancelled
+func (s *Server) Serve(ctx context.Context) error {
+	server := http.Server{
+		Addr:    s.address,
+		Handler: s,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Serving the admin API", "address", s.address)
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package admin
+
+import (
+	"moon/config"
+	"moon/indexer"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//newTestServer serves the admin API of an indexer syncing
+//board a into no sink, without a database, so only requests
+//answered before reaching Postgres can be made
+func newTestServer() (*Server, *indexer.Indexer) {
+	ix := indexer.NewIndexer(config.Config{Boards: []config.BoardConfig{{Name: "a"}}}, nil, nil)
+
+	return NewServer(config.AdminConfig{Token: "secret"}, ix, nil), ix
+}
+
+func serve(s *Server, method string, target string, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestUnauthorized(t *testing.T) {
+	s, _ := newTestServer()
+
+	for _, token := range []string{"", "wrong", "secret "} {
+		w := serve(s, http.MethodGet, "/boards", token)
+
+		if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("GET /boards with token %q = %d, want 401 asking for a bearer token", token, w.Code)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/boards/a/pause", nil)
+	r.Header.Set("Authorization", "Basic secret")
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("POST /boards/a/pause with basic auth = %d, want 401", w.Code)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		code   int
+		body   string
+	}{
+		{http.MethodPost, "/boards", http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/boards/a/sync", http.StatusMethodNotAllowed, ""},
+		{http.MethodPost, "/boards/a/sync", http.StatusAccepted, ""},
+		{http.MethodPost, "/boards/b/sync", http.StatusNotFound, "Unknown board"},
+		{http.MethodPost, "/boards/b/pause", http.StatusNotFound, "Unknown board"},
+		{http.MethodPost, "/boards/b/reindex", http.StatusNotFound, "Unknown board"},
+		{http.MethodPost, "/boards/a/rebuild", http.StatusNotFound, "404 page not found"},
+		{http.MethodPost, "/boards/a/sync/now", http.StatusNotFound, "404 page not found"},
+		{http.MethodGet, "/posts", http.StatusNotFound, "404 page not found"},
+
+		{http.MethodGet, "/boards/b/dead-letters", http.StatusNotFound, "Unknown board"},
+		{http.MethodPost, "/boards/b/dead-letters/retry", http.StatusNotFound, "Unknown board"},
+		{http.MethodPost, "/boards/b/dead-letters/discard?posts=1,2", http.StatusNotFound, "Unknown board"},
+		{http.MethodPost, "/boards/a/dead-letters", http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/boards/a/dead-letters/retry", http.StatusMethodNotAllowed, ""},
+		{http.MethodDelete, "/boards/a/dead-letters/discard", http.StatusMethodNotAllowed, ""},
+		{http.MethodPost, "/boards/a/dead-letters/requeue", http.StatusNotFound, "404 page not found"},
+		{http.MethodPost, "/boards/a/dead-letters/retry/now", http.StatusNotFound, "404 page not found"},
+		{http.MethodGet, "/boards/a/dead-letters?posts=1,a", http.StatusBadRequest, ""},
+	}
+
+	s, _ := newTestServer()
+
+	for _, test := range tests {
+		w := serve(s, test.method, test.target, "secret")
+
+		if w.Code != test.code || !strings.HasPrefix(w.Body.String(), test.body) {
+			t.Errorf("%s %s = %d %q, want %d %q", test.method, test.target, w.Code, w.Body.String(), test.code, test.body)
+		}
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	s, ix := newTestServer()
+
+	if w := serve(s, http.MethodPost, "/boards/a/pause", "secret"); w.Code != http.StatusAccepted || !ix.Paused("a") {
+		t.Errorf("POST /boards/a/pause = %d, want 202 and the board paused", w.Code)
+	}
+
+	if w := serve(s, http.MethodPost, "/boards/a/resume", "secret"); w.Code != http.StatusAccepted || ix.Paused("a") {
+		t.Errorf("POST /boards/a/resume = %d, want 202 and the board resumed", w.Code)
+	}
+}
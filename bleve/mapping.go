@@ -0,0 +1,55 @@
+//Package bleve indexes posts into embedded on-disk Bleve
+//indexes and serves searches on them, so Moon and Postgres
+//make up a complete search stack by themselves
+package bleve
+
+import (
+	"moon/lnx"
+
+	blevesearch "github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/mapping"
+)
+
+//buildIndexMapping builds a mapping equivalent to the schema
+//of an Lnx index. Search fields are the only ones included in
+//the default field, so unqualified queries search them alone.
+func buildIndexMapping(schema lnx.Schema) mapping.IndexMapping {
+	isSearchField := make(map[string]bool, len(schema.SearchFields))
+
+	for _, f := range schema.SearchFields {
+		isSearchField[f] = true
+	}
+
+	documentMapping := blevesearch.NewDocumentStaticMapping()
+
+	for name, field := range schema.Fields {
+		var fieldMapping *mapping.FieldMapping
+
+		switch field.Type {
+		case "i64", "f64":
+			fieldMapping = blevesearch.NewNumericFieldMapping()
+		case "date":
+			fieldMapping = blevesearch.NewDateTimeFieldMapping()
+		case "string":
+			fieldMapping = blevesearch.NewKeywordFieldMapping()
+		default:
+			fieldMapping = blevesearch.NewTextFieldMapping()
+			fieldMapping.Analyzer = standard.Name
+		}
+
+		fieldMapping.Store = field.Stored
+		fieldMapping.Index = field.Indexed
+		fieldMapping.DocValues = field.Fast
+		fieldMapping.IncludeInAll = isSearchField[name]
+		fieldMapping.IncludeTermVectors = false
+
+		documentMapping.AddFieldMappingsAt(name, fieldMapping)
+	}
+
+	indexMapping := blevesearch.NewIndexMapping()
+	indexMapping.DefaultMapping = documentMapping
+	indexMapping.DefaultAnalyzer = standard.Name
+
+	return indexMapping
+}
@@ -0,0 +1,126 @@
+package bleve
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	blevesearch "github.com/blevesearch/bleve/v2"
+)
+
+//searchResponse is the response to a search,
+//holding the post numbers of the matching posts
+type searchResponse struct {
+	Count int64       `json:"count"`
+	Hits  []searchHit `json:"hits"`
+}
+
+type searchHit struct {
+	PostNumber int64   `json:"post_number"`
+	Score      float64 `json:"score"`
+}
+
+//ServeHTTP serves searches on an index as
+//GET /search?index=post_b&q=query&limit=20&offset=0&sort=-post_number
+//where q uses the Bleve query string syntax and sort is a comma
+//separated list of fields, descending if prefixed with a minus.
+//The index a board is served from is found in the index_alias table.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/search" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+
+	index, ok := s.index(params.Get("index"))
+
+	if !ok {
+		http.Error(w, "Unknown index", http.StatusNotFound)
+		return
+	}
+
+	limit, err := strconv.Atoi(params.Get("limit"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 20
+	}
+
+	offset, err := strconv.Atoi(params.Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	q := params.Get("q")
+
+	var searchRequest *blevesearch.SearchRequest
+
+	if q == "" {
+		searchRequest = blevesearch.NewSearchRequestOptions(blevesearch.NewMatchAllQuery(), limit, offset, false)
+	} else {
+		searchRequest = blevesearch.NewSearchRequestOptions(blevesearch.NewQueryStringQuery(q), limit, offset, false)
+	}
+
+	if sort := params.Get("sort"); sort != "" {
+		searchRequest.SortBy(strings.Split(sort, ","))
+	}
+
+	result, err := index.SearchInContext(r.Context(), searchRequest)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := searchResponse{
+		Count: int64(result.Total),
+		Hits:  make([]searchHit, 0, len(result.Hits)),
+	}
+
+	for _, hit := range result.Hits {
+		postNumber, err := strconv.ParseInt(hit.ID, 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		response.Hits = append(response.Hits, searchHit{PostNumber: postNumber, Score: hit.Score})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&response)
+}
+
+//Serve serves searches on address until ctx is cancelled
+func (s *Service) Serve(ctx context.Context, address string) error {
+	server := http.Server{
+		Addr:    address,
+		Handler: s,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Serving searches", "address", address)
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,268 @@
+package bleve
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"moon/config"
+	"moon/db"
+	"moon/lnx"
+	"moon/sink"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	blevesearch "github.com/blevesearch/bleve/v2"
+)
+
+var _ sink.Sink = (*Service)(nil)
+
+//Service wraps writes and upserts to on-disk Bleve
+//indexes. Modifications are gathered in a batch that is
+//applied to the index on Commit, or as soon as it grows
+//to maxBatchSize so memory stays bounded. Rollback only
+//discards what wasn't applied yet, which is fine as the
+//pass being retried writes the same posts again.
+type Service struct {
+	dataDir      string
+	maxBatchSize int
+
+	mutex   sync.RWMutex
+	indexes map[string]blevesearch.Index
+	batches map[string]*blevesearch.Batch
+}
+
+//NewService constructs and returns a Service
+func NewService(conf config.BleveConfig) *Service {
+	maxBatchSize := conf.MaxBatchSize
+
+	if maxBatchSize <= 0 {
+		maxBatchSize = 10000
+	}
+
+	return &Service{
+		dataDir:      conf.DataDir,
+		maxBatchSize: maxBatchSize,
+		indexes:      make(map[string]blevesearch.Index),
+		batches:      make(map[string]*blevesearch.Batch),
+	}
+}
+
+//Upsert upserts an array of posts into the pending
+//batch of the index, deleting hidden posts
+func (s *Service) Upsert(ctx context.Context, posts []db.Post, index string, previousScrape time.Time) error {
+	batch, err := s.batch(index)
+
+	if err != nil {
+		return err
+	}
+
+	for i := range posts {
+		id := strconv.FormatInt(posts[i].PostNumber, 10)
+
+		if posts[i].Hidden {
+			batch.Delete(id)
+			continue
+		}
+
+		if err := batch.Index(id, lnx.DbPostToLnxPost(&posts[i])); err != nil {
+			return fmt.Errorf("Error indexing post %s: %w", id, err)
+		}
+	}
+
+	return s.flushIfFull(index, batch)
+}
+
+//Delete adds deletions for an array of posts
+//to the pending batch of the index
+func (s *Service) Delete(ctx context.Context, posts []db.Post, index string) error {
+	batch, err := s.batch(index)
+
+	if err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		batch.Delete(strconv.FormatInt(p.PostNumber, 10))
+	}
+
+	return s.flushIfFull(index, batch)
+}
+
+//Commit applies the pending batch of the index
+func (s *Service) Commit(ctx context.Context, index string) error {
+	s.mutex.Lock()
+	bleveIndex, ok := s.indexes[index]
+	batch := s.batches[index]
+	delete(s.batches, index)
+	s.mutex.Unlock()
+
+	if !ok {
+		return fmt.Errorf("Index %s is not open", index)
+	}
+
+	if batch == nil || batch.Size() == 0 {
+		return nil
+	}
+
+	if err := bleveIndex.Batch(batch); err != nil {
+		return fmt.Errorf("Error committing index %s: %w", index, err)
+	}
+
+	return nil
+}
+
+//Rollback discards the pending batch of the index. Batches
+//already flushed stay, and get overwritten as the posts in
+//them are upserted again by the retried pass.
+func (s *Service) Rollback(ctx context.Context, index string) error {
+	s.mutex.Lock()
+	delete(s.batches, index)
+	s.mutex.Unlock()
+
+	return nil
+}
+
+//CreateIndex opens an index, creating it with a mapping
+//equivalent to the schema of the board if it doesn't exist
+func (s *Service) CreateIndex(ctx context.Context, index string, conf config.BoardConfig) error {
+	schema, err := lnx.NewSchema(conf.Schema)
+
+	if err != nil {
+		return fmt.Errorf("Error building schema for index %s: %w", index, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.indexes[index]; ok {
+		return nil
+	}
+
+	if err := os.MkdirAll(s.dataDir, 0o755); err != nil {
+		return fmt.Errorf("Error creating data directory: %w", err)
+	}
+
+	path := s.path(index)
+
+	bleveIndex, err := blevesearch.Open(path)
+
+	if err == blevesearch.ErrorIndexPathDoesNotExist {
+		slog.Info("Creating index", "sink", "bleve", "index", index, "path", path)
+		bleveIndex, err = blevesearch.New(path, buildIndexMapping(schema))
+	}
+
+	if err != nil {
+		return fmt.Errorf("Error opening index %s: %w", path, err)
+	}
+
+	s.indexes[index] = bleveIndex
+
+	return nil
+}
+
+//DropIndex closes an index and removes it from disk
+func (s *Service) DropIndex(ctx context.Context, index string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if bleveIndex, ok := s.indexes[index]; ok {
+		bleveIndex.Close()
+		delete(s.indexes, index)
+		delete(s.batches, index)
+	}
+
+	if err := os.RemoveAll(s.path(index)); err != nil {
+		return fmt.Errorf("Error removing index %s: %w", index, err)
+	}
+
+	return nil
+}
+
+//Count returns the number of posts in an index
+func (s *Service) Count(ctx context.Context, index string) (int64, error) {
+	bleveIndex, ok := s.index(index)
+
+	if !ok {
+		return 0, fmt.Errorf("Index %s is not open", index)
+	}
+
+	count, err := bleveIndex.DocCount()
+
+	return int64(count), err
+}
+
+//Close closes every open index
+func (s *Service) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var firstErr error
+
+	for index, bleveIndex := range s.indexes {
+		if err := bleveIndex.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		delete(s.indexes, index)
+	}
+
+	return firstErr
+}
+
+func (s *Service) batch(index string) (*blevesearch.Batch, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	bleveIndex, ok := s.indexes[index]
+
+	if !ok {
+		return nil, fmt.Errorf("Index %s is not open", index)
+	}
+
+	batch, ok := s.batches[index]
+
+	if !ok {
+		batch = bleveIndex.NewBatch()
+		s.batches[index] = batch
+	}
+
+	return batch, nil
+}
+
+//flushIfFull applies the pending batch of the index once
+//it holds maxBatchSize modifications, emptying it
+func (s *Service) flushIfFull(index string, batch *blevesearch.Batch) error {
+	if batch.Size() < s.maxBatchSize {
+		return nil
+	}
+
+	bleveIndex, ok := s.index(index)
+
+	if !ok {
+		return fmt.Errorf("Index %s is not open", index)
+	}
+
+	if err := bleveIndex.Batch(batch); err != nil {
+		return fmt.Errorf("Error flushing index %s: %w", index, err)
+	}
+
+	batch.Reset()
+
+	return nil
+}
+
+func (s *Service) index(index string) (blevesearch.Index, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	bleveIndex, ok := s.indexes[index]
+
+	return bleveIndex, ok
+}
+
+func (s *Service) path(index string) string {
+	return filepath.Join(s.dataDir, fmt.Sprintf("%s.bleve", index))
+}
@@ -0,0 +1,143 @@
+package bleve
+
+import (
+	"context"
+	"moon/config"
+	"moon/db"
+	"testing"
+	"time"
+)
+
+func newTestService(t *testing.T, maxBatchSize int) *Service {
+	t.Helper()
+
+	s := NewService(config.BleveConfig{DataDir: t.TempDir(), MaxBatchSize: maxBatchSize})
+
+	t.Cleanup(func() {
+		s.Close()
+	})
+
+	if err := s.CreateIndex(context.Background(), "post_a", config.BoardConfig{Name: "a"}); err != nil {
+		t.Fatalf("CreateIndex() failed: %s", err)
+	}
+
+	return s
+}
+
+func testPosts(postNumbers ...int64) []db.Post {
+	posts := make([]db.Post, 0, len(postNumbers))
+
+	for _, postNumber := range postNumbers {
+		posts = append(posts, db.Post{Board: "a", PostNumber: postNumber, TimePosted: time.Unix(postNumber, 0)})
+	}
+
+	return posts
+}
+
+func assertCount(t *testing.T, s *Service, want int64) {
+	t.Helper()
+
+	count, err := s.Count(context.Background(), "post_a")
+
+	if err != nil {
+		t.Fatalf("Count() failed: %s", err)
+	}
+
+	if count != want {
+		t.Errorf("Count() = %d, want %d", count, want)
+	}
+}
+
+func TestUpsertCommit(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, 0)
+
+	if err := s.Upsert(ctx, testPosts(1, 2, 3), "post_a", time.Time{}); err != nil {
+		t.Fatalf("Upsert() failed: %s", err)
+	}
+
+	assertCount(t, s, 0)
+
+	if err := s.Commit(ctx, "post_a"); err != nil {
+		t.Fatalf("Commit() failed: %s", err)
+	}
+
+	assertCount(t, s, 3)
+
+	hidden := testPosts(2, 4)
+	hidden[0].Hidden = true
+
+	if err := s.Upsert(ctx, hidden, "post_a", time.Time{}); err != nil {
+		t.Fatalf("Upsert() failed: %s", err)
+	}
+
+	if err := s.Commit(ctx, "post_a"); err != nil {
+		t.Fatalf("Commit() failed: %s", err)
+	}
+
+	assertCount(t, s, 3)
+}
+
+func TestDeleteRollback(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, 0)
+
+	if err := s.Upsert(ctx, testPosts(1, 2, 3), "post_a", time.Time{}); err != nil {
+		t.Fatalf("Upsert() failed: %s", err)
+	}
+
+	if err := s.Commit(ctx, "post_a"); err != nil {
+		t.Fatalf("Commit() failed: %s", err)
+	}
+
+	if err := s.Delete(ctx, testPosts(1, 2), "post_a"); err != nil {
+		t.Fatalf("Delete() failed: %s", err)
+	}
+
+	if err := s.Rollback(ctx, "post_a"); err != nil {
+		t.Fatalf("Rollback() failed: %s", err)
+	}
+
+	if err := s.Commit(ctx, "post_a"); err != nil {
+		t.Fatalf("Commit() failed: %s", err)
+	}
+
+	assertCount(t, s, 3)
+
+	if err := s.Delete(ctx, testPosts(1, 2), "post_a"); err != nil {
+		t.Fatalf("Delete() failed: %s", err)
+	}
+
+	if err := s.Commit(ctx, "post_a"); err != nil {
+		t.Fatalf("Commit() failed: %s", err)
+	}
+
+	assertCount(t, s, 1)
+}
+
+func TestUpsertFlushesFullBatches(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, 2)
+
+	if err := s.Upsert(ctx, testPosts(1, 2, 3), "post_a", time.Time{}); err != nil {
+		t.Fatalf("Upsert() failed: %s", err)
+	}
+
+	assertCount(t, s, 3)
+
+	if err := s.Upsert(ctx, testPosts(4), "post_a", time.Time{}); err != nil {
+		t.Fatalf("Upsert() failed: %s", err)
+	}
+
+	assertCount(t, s, 3)
+
+	if err := s.Rollback(ctx, "post_a"); err != nil {
+		t.Fatalf("Rollback() failed: %s", err)
+	}
+
+	if err := s.Commit(ctx, "post_a"); err != nil {
+		t.Fatalf("Commit() failed: %s", err)
+	}
+
+	assertCount(t, s, 3)
+}
@@ -13,13 +13,106 @@ type Config struct {
 	Boards         []BoardConfig  `toml:"boards"`
 	PostgresConfig PostgresConfig `toml:"postgres"`
 	LnxConfig      LnxConfig      `toml:"lnx"`
+	SyncConfig     SyncConfig     `toml:"sync"`
+	SchemaConfig   SchemaConfig   `toml:"schema"`
+	AdminConfig    AdminConfig    `toml:"admin"`
+
+	MonitoringConfig MonitoringConfig `toml:"monitoring"`
+	LogConfig        LogConfig        `toml:"log"`
+
+	MeilisearchConfig   MeilisearchConfig   `toml:"meilisearch"`
+	ElasticsearchConfig ElasticsearchConfig `toml:"elasticsearch"`
+	TypesenseConfig     TypesenseConfig     `toml:"typesense"`
+	BleveConfig         BleveConfig         `toml:"bleve"`
+	JSONLConfig         JSONLConfig         `toml:"jsonl"`
 }
 
 //BoardConfig parametrizes Moon's configuration
 //for indexing a board in Lnx
 type BoardConfig struct {
-	Name          string `toml:"name"`
-	ForceRecreate bool   `toml:"force_recreate"`
+	Name   string       `toml:"name"`
+	Schema SchemaConfig `toml:"schema"`
+
+	//ForceRecreate is refused on startup in
+	//favour of reindex requests
+	ForceRecreate bool `toml:"force_recreate"`
+}
+
+//SchemaConfig parametrizes the index a board gets.
+//Anything left unset keeps its default value.
+type SchemaConfig struct {
+	Fields                  map[string]FieldConfig `toml:"fields"`
+	SearchFields            []string               `toml:"search_fields"`
+	StripStopWords          *bool                  `toml:"strip_stop_words"`
+	SetConjunctionByDefault *bool                  `toml:"set_conjunction_by_default"`
+}
+
+//FieldConfig parametrizes a single field of the index
+type FieldConfig struct {
+	Type     string `toml:"type"`
+	Stored   *bool  `toml:"stored"`
+	Indexed  *bool  `toml:"indexed"`
+	Fast     *bool  `toml:"fast"`
+	Required *bool  `toml:"required"`
+}
+
+//Override returns the schema with everything
+//set in other taking precedence
+func (s SchemaConfig) Override(other SchemaConfig) SchemaConfig {
+	result := SchemaConfig{
+		Fields:                  make(map[string]FieldConfig, len(s.Fields)+len(other.Fields)),
+		SearchFields:            s.SearchFields,
+		StripStopWords:          s.StripStopWords,
+		SetConjunctionByDefault: s.SetConjunctionByDefault,
+	}
+
+	for name, field := range s.Fields {
+		result.Fields[name] = field
+	}
+
+	for name, field := range other.Fields {
+		result.Fields[name] = result.Fields[name].Override(field)
+	}
+
+	if other.SearchFields != nil {
+		result.SearchFields = other.SearchFields
+	}
+
+	if other.StripStopWords != nil {
+		result.StripStopWords = other.StripStopWords
+	}
+
+	if other.SetConjunctionByDefault != nil {
+		result.SetConjunctionByDefault = other.SetConjunctionByDefault
+	}
+
+	return result
+}
+
+//Override returns the field with everything
+//set in other taking precedence
+func (f FieldConfig) Override(other FieldConfig) FieldConfig {
+	if other.Type != "" {
+		f.Type = other.Type
+	}
+
+	if other.Stored != nil {
+		f.Stored = other.Stored
+	}
+
+	if other.Indexed != nil {
+		f.Indexed = other.Indexed
+	}
+
+	if other.Fast != nil {
+		f.Fast = other.Fast
+	}
+
+	if other.Required != nil {
+		f.Required = other.Required
+	}
+
+	return f
 }
 
 //PostgresConfig parametrizes configuration
@@ -38,6 +131,100 @@ type LnxConfig struct {
 	ReaderThreads  int    `toml:"reader_threads"`
 	MaxConcurrency int    `toml:"max_concurrency"`
 	WriterBuffer   int    `toml:"writer_buffer"`
+
+	Retry LnxRetryConfig `toml:"retry"`
+}
+
+//LnxRetryConfig parametrizes how requests
+//to Lnx that failed are retried
+type LnxRetryConfig struct {
+	MaxAttempts       int      `toml:"max_attempts"`
+	BaseDelay         string   `toml:"base_delay"`
+	MaxDelay          string   `toml:"max_delay"`
+	Jitter            *float64 `toml:"jitter"`
+	RetryableStatuses []int    `toml:"retryable_statuses"`
+	Deadline          string   `toml:"deadline"`
+}
+
+//MeilisearchConfig parametrizes configuration
+//for indexing into Meilisearch
+type MeilisearchConfig struct {
+	Host   string `toml:"host"`
+	Port   int    `toml:"port"`
+	APIKey string `toml:"api_key"`
+}
+
+//ElasticsearchConfig parametrizes configuration for
+//indexing into Elasticsearch or OpenSearch
+type ElasticsearchConfig struct {
+	Host     string `toml:"host"`
+	Port     int    `toml:"port"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+}
+
+//TypesenseConfig parametrizes configuration
+//for indexing into Typesense
+type TypesenseConfig struct {
+	Host   string `toml:"host"`
+	Port   int    `toml:"port"`
+	APIKey string `toml:"api_key"`
+}
+
+//BleveConfig parametrizes configuration for
+//indexing into embedded Bleve indexes
+type BleveConfig struct {
+	DataDir       string `toml:"data_dir"`
+	SearchAddress string `toml:"search_address"`
+	MaxBatchSize  int    `toml:"max_batch_size"`
+}
+
+//JSONLConfig parametrizes configuration for
+//exporting posts into NDJSON files
+type JSONLConfig struct {
+	Dir         string `toml:"dir"`
+	Gzip        bool   `toml:"gzip"`
+	MaxFileSize int64  `toml:"max_file_size"`
+}
+
+//AdminConfig parametrizes the admin API
+type AdminConfig struct {
+	Address string `toml:"address"`
+	Token   string `toml:"token"`
+}
+
+//MonitoringConfig parametrizes the endpoints
+//monitoring systems scrape
+type MonitoringConfig struct {
+	Address         string `toml:"address"`
+	WatchdogTimeout string `toml:"watchdog_timeout"`
+}
+
+//LogConfig parametrizes what Moon logs and how
+type LogConfig struct {
+	Format string `toml:"format"`
+	Level  string `toml:"level"`
+}
+
+//SyncConfig parametrizes how Moon schedules
+//the indexing of boards
+type SyncConfig struct {
+	Sinks         []string `toml:"sinks"`
+	Sink          string   `toml:"sink"`
+	Concurrency   int      `toml:"concurrency"`
+	ListenChannel string   `toml:"listen_channel"`
+	Debounce      string   `toml:"debounce"`
+
+	CheckpointBatches  int    `toml:"checkpoint_batches"`
+	CheckpointInterval string `toml:"checkpoint_interval"`
+
+	MaxConsecutiveFailures int    `toml:"max_consecutive_failures"`
+	BackoffBase            string `toml:"backoff_base"`
+	BackoffMax             string `toml:"backoff_max"`
+
+	SchemaDrift string `toml:"schema_drift"`
+
+	StartupTimeout string `toml:"startup_timeout"`
 }
 
 //LoadConfig reads config.json and unmarshals it into a Config struct.
@@ -62,5 +249,9 @@ func LoadConfig() Config {
 		log.Fatalln(err)
 	}
 
+	for i := range conf.Boards {
+		conf.Boards[i].Schema = conf.SchemaConfig.Override(conf.Boards[i].Schema)
+	}
+
 	return conf
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"moon/config"
+	"moon/db"
+	"moon/indexer"
+
+	"github.com/uptrace/bun"
+)
+
+//createIndex creates the alias, tracker and index
+//of a board in every sink without syncing anything
+func createIndex(ctx context.Context, conf config.Config, pg *bun.DB, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Usage: moon create-index <board>")
+	}
+
+	boardConf, err := boardConfig(conf, args[0])
+
+	if err != nil {
+		return err
+	}
+
+	conf.Boards = []config.BoardConfig{boardConf}
+
+	if err := db.Migrate(ctx, pg); err != nil {
+		return err
+	}
+
+	sinks, err := newSinks(ctx, conf)
+
+	if err != nil {
+		return err
+	}
+
+	moonIndexer := indexer.NewIndexer(conf, pg, sinks)
+
+	err = moonIndexer.Prepare(ctx)
+
+	if closeErr := closeSinks(sinks); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Created index", "board", boardConf.Name)
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+//DeadLetter is a post a sink rejected, set aside so the
+//rest of the board could be synced. Moon sends it again on
+//the next pass over the board once a retry is requested.
+type DeadLetter struct {
+	bun.BaseModel `bun:"table:moon_dead_letter,alias:dead_letter"`
+
+	ID               int64           `bun:"id,pk,autoincrement" json:"id"`
+	Sink             string          `bun:"sink" json:"sink"`
+	Board            string          `bun:"board" json:"board"`
+	PostNumber       int64           `bun:"post_number" json:"post_number"`
+	IndexName        string          `bun:"index_name" json:"index_name"`
+	Error            string          `bun:"error" json:"error"`
+	Payload          json.RawMessage `bun:"payload,type:jsonb" json:"payload"`
+	CreatedAt        time.Time       `bun:"created_at,nullzero,notnull,default:current_timestamp" json:"created_at"`
+	RetryRequestedAt *time.Time      `bun:"retry_requested_at" json:"retry_requested_at,omitempty"`
+}
@@ -0,0 +1,15 @@
+package db
+
+import "github.com/uptrace/bun"
+
+//IndexAlias points to the index a board is served
+//from in a sink, which is what searches should read
+//from. Rebuilds switch it over once the new index
+//has caught up.
+type IndexAlias struct {
+	bun.BaseModel `bun:"table:index_alias"`
+
+	Sink      string `bun:"sink,pk"`
+	Board     string `bun:"board,pk"`
+	IndexName string `bun:"index_name"`
+}
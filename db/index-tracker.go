@@ -6,12 +6,20 @@ import (
 	"github.com/uptrace/bun"
 )
 
-//IndexTracker tracks how far an Lnx index
-//has been synced up with the postgres database
+//IndexTracker tracks how far an index of a board
+//in a sink has been synced up with the postgres database.
+//A board has more than one tracker while its index is
+//being rebuilt.
 type IndexTracker struct {
 	bun.BaseModel `bun:"table:index_tracker"`
 
+	Sink         string    `bun:"sink,pk"`
 	Board        string    `bun:"board,pk"`
+	IndexName    string    `bun:"index_name,pk"`
 	LastModified time.Time `bun:"last_modified"`
 	PostNumber   int64     `bun:"post_number"`
+
+	//SchemaFingerprint identifies the schema the index was
+	//created with, empty for indexes created before it was kept
+	SchemaFingerprint string `bun:"schema_fingerprint"`
 }
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+//migrations bring the tables Moon owns up to date.
+//Every statement must be safe to run more than once.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS index_tracker (
+		sink TEXT NOT NULL DEFAULT 'lnx',
+		board TEXT NOT NULL,
+		last_modified TIMESTAMPTZ NOT NULL,
+		post_number BIGINT NOT NULL,
+		PRIMARY KEY (sink, board)
+	)`,
+	`ALTER TABLE index_tracker ADD COLUMN IF NOT EXISTS sink TEXT NOT NULL DEFAULT 'lnx'`,
+	`DO $$
+	BEGIN
+		IF NOT EXISTS (
+			SELECT 1
+			FROM information_schema.key_column_usage
+			WHERE table_name = 'index_tracker'
+				AND constraint_name = 'index_tracker_pkey'
+				AND column_name = 'sink'
+		) THEN
+			ALTER TABLE index_tracker DROP CONSTRAINT IF EXISTS index_tracker_pkey;
+			ALTER TABLE index_tracker ADD PRIMARY KEY (sink, board);
+		END IF;
+	END $$`,
+	`ALTER TABLE index_tracker ADD COLUMN IF NOT EXISTS index_name TEXT`,
+	`UPDATE index_tracker SET index_name = 'post_' || board WHERE index_name IS NULL`,
+	`ALTER TABLE index_tracker ALTER COLUMN index_name SET NOT NULL`,
+	`DO $$
+	BEGIN
+		IF NOT EXISTS (
+			SELECT 1
+			FROM information_schema.key_column_usage
+			WHERE table_name = 'index_tracker'
+				AND constraint_name = 'index_tracker_pkey'
+				AND column_name = 'index_name'
+		) THEN
+			ALTER TABLE index_tracker DROP CONSTRAINT IF EXISTS index_tracker_pkey;
+			ALTER TABLE index_tracker ADD PRIMARY KEY (sink, board, index_name);
+		END IF;
+	END $$`,
+	`CREATE TABLE IF NOT EXISTS index_alias (
+		sink TEXT NOT NULL,
+		board TEXT NOT NULL,
+		index_name TEXT NOT NULL,
+		PRIMARY KEY (sink, board)
+	)`,
+	`ALTER TABLE index_tracker ADD COLUMN IF NOT EXISTS schema_fingerprint TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS reindex_request (
+		id BIGSERIAL PRIMARY KEY,
+		sink TEXT NOT NULL,
+		board TEXT NOT NULL,
+		requested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		done_at TIMESTAMPTZ
+	)`,
+	`CREATE TABLE IF NOT EXISTS moon_dead_letter (
+		id BIGSERIAL PRIMARY KEY,
+		sink TEXT NOT NULL,
+		board TEXT NOT NULL,
+		post_number BIGINT NOT NULL,
+		index_name TEXT NOT NULL,
+		error TEXT NOT NULL,
+		payload JSONB NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		retry_requested_at TIMESTAMPTZ,
+		UNIQUE (sink, board, post_number)
+	)`,
+	`ALTER TABLE moon_dead_letter DROP CONSTRAINT IF EXISTS moon_dead_letter_sink_board_post_number_key`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS moon_dead_letter_index_post_number ON moon_dead_letter (sink, board, index_name, post_number)`,
+	`ALTER TABLE reindex_request ADD COLUMN IF NOT EXISTS index_name TEXT`,
+}
+
+//Migrate runs every migration in order
+func Migrate(ctx context.Context, pg *bun.DB) error {
+	for i, migration := range migrations {
+		if _, err := pg.ExecContext(ctx, migration); err != nil {
+			return fmt.Errorf("Error running migration %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,22 @@
+package db
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+//ReindexRequest asks Moon to rebuild the index of a
+//board in a sink once. Moon marks it as done as soon
+//as a rebuild is started, or found already underway,
+//recording the index that rebuild builds.
+type ReindexRequest struct {
+	bun.BaseModel `bun:"table:reindex_request"`
+
+	ID          int64      `bun:"id,pk,autoincrement"`
+	Sink        string     `bun:"sink"`
+	Board       string     `bun:"board"`
+	RequestedAt time.Time  `bun:"requested_at,nullzero,notnull,default:current_timestamp"`
+	DoneAt      *time.Time `bun:"done_at"`
+	IndexName   *string    `bun:"index_name"`
+}
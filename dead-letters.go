@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"moon/config"
+	"moon/db"
+	"moon/indexer"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+//deadLetters lists the posts of a board sinks rejected, or
+//requests them to be retried or discards them. Retries are
+//taken on the next pass over the board, which a running Moon
+//is woken up for through the listen channel.
+func deadLetters(ctx context.Context, conf config.Config, pg *bun.DB, args []string) error {
+	fs := flag.NewFlagSet("dead-letters", flag.ContinueOnError)
+	retry := fs.Bool("retry", false, "Retry the dead letters on the next pass")
+	discard := fs.Bool("discard", false, "Delete the dead letters")
+	sinkName := fs.String("sink", "", "Only act on the dead letters of this sink")
+	posts := fs.String("posts", "", "Only act on the dead letters of these comma separated post numbers")
+
+	positional, err := parseArgs(fs, args)
+
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 1 || (*retry && *discard) {
+		return fmt.Errorf("Usage: moon dead-letters <board> [--retry | --discard] [--sink s] [--posts n,...]")
+	}
+
+	boardConf, err := boardConfig(conf, positional[0])
+
+	if err != nil {
+		return err
+	}
+
+	board := boardConf.Name
+	sinks := sinkNames(conf)
+
+	if *sinkName != "" {
+		sinks = []string{*sinkName}
+	}
+
+	postNumbers, err := indexer.ParsePostNumbers(*posts)
+
+	if err != nil {
+		return err
+	}
+
+	if err := db.Migrate(ctx, pg); err != nil {
+		return err
+	}
+
+	switch {
+	case *retry:
+		n, err := indexer.RetryDeadLetters(ctx, pg, board, sinks, postNumbers)
+
+		if err != nil {
+			return fmt.Errorf("Error requesting retry of dead letters of board %s: %w", board, err)
+		}
+
+		if conf.SyncConfig.ListenChannel != "" {
+			if _, err := pg.ExecContext(ctx, "SELECT pg_notify(?, ?)", conf.SyncConfig.ListenChannel, board); err != nil {
+				slog.Warn("Error notifying channel", "channel", conf.SyncConfig.ListenChannel, "error", err)
+			}
+		}
+
+		slog.Info("Requested retry of dead letters", "board", board, "dead_letters", n)
+	case *discard:
+		n, err := indexer.DiscardDeadLetters(ctx, pg, board, sinks, postNumbers)
+
+		if err != nil {
+			return fmt.Errorf("Error discarding dead letters of board %s: %w", board, err)
+		}
+
+		slog.Info("Discarded dead letters", "board", board, "dead_letters", n)
+	default:
+		deadLetters, err := indexer.DeadLetters(ctx, pg, board, sinks, postNumbers)
+
+		if err != nil {
+			return fmt.Errorf("Error reading dead letters of board %s: %w", board, err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SINK\tPOST NUMBER\tINDEX\tCREATED AT\tRETRYING\tERROR")
+
+		for _, d := range deadLetters {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%t\t%s\n", d.Sink, d.PostNumber, d.IndexName, d.CreatedAt.Format(time.RFC3339), d.RetryRequestedAt != nil, d.Error)
+		}
+
+		return w.Flush()
+	}
+
+	return nil
+}
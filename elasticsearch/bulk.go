@@ -0,0 +1,78 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"strings"
+)
+
+//bulkAction is the action line preceding every
+//document in a _bulk request
+type bulkAction struct {
+	Index  *bulkTarget `json:"index,omitempty"`
+	Delete *bulkTarget `json:"delete,omitempty"`
+}
+
+type bulkTarget struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+//bulkResponse is the response to a _bulk request,
+//holding the result of every action
+type bulkResponse struct {
+	Errors bool                          `json:"errors"`
+	Items  []map[string]bulkItemResponse `json:"items"`
+}
+
+type bulkItemResponse struct {
+	ID     string     `json:"_id"`
+	Status int        `json:"status"`
+	Error  *bulkError `json:"error"`
+}
+
+type bulkError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+//BulkError is returned when some of the actions
+//in a _bulk request fail
+type BulkError struct {
+	Failed  int
+	Total   int
+	Reasons []string
+}
+
+func (e *BulkError) Error() string {
+	return fmt.Sprintf("%d out of %d bulk actions failed: %s", e.Failed, e.Total, strings.Join(e.Reasons, "; "))
+}
+
+//check turns per-item failures into a BulkError. Deleting a
+//document that doesn't exist is not considered a failure.
+func (r *bulkResponse) check() error {
+	if !r.Errors {
+		return nil
+	}
+
+	bulkErr := BulkError{Total: len(r.Items)}
+
+	for _, item := range r.Items {
+		for action, result := range item {
+			if result.Error == nil || (action == "delete" && result.Status == 404) {
+				continue
+			}
+
+			bulkErr.Failed++
+
+			if len(bulkErr.Reasons) < 5 {
+				bulkErr.Reasons = append(bulkErr.Reasons, fmt.Sprintf("%s %s: %s (%s)", action, result.ID, result.Error.Reason, result.Error.Type))
+			}
+		}
+	}
+
+	if bulkErr.Failed == 0 {
+		return nil
+	}
+
+	return &bulkErr
+}
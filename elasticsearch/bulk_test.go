@@ -0,0 +1,88 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBulkResponseCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		failed int
+	}{
+		{
+			"no errors",
+			`{"errors": false, "items": [{"index": {"_id": "1", "status": 201}}]}`,
+			0,
+		},
+		{
+			"missing deletes",
+			`{"errors": true, "items": [
+				{"index": {"_id": "1", "status": 201}},
+				{"delete": {"_id": "2", "status": 404, "error": {"type": "not_found", "reason": "gone"}}}
+			]}`,
+			0,
+		},
+		{
+			"failed items",
+			`{"errors": true, "items": [
+				{"index": {"_id": "1", "status": 201}},
+				{"index": {"_id": "2", "status": 400, "error": {"type": "mapper_parsing_exception", "reason": "failed to parse field [time_posted]"}}},
+				{"delete": {"_id": "3", "status": 500, "error": {"type": "exception", "reason": "shard failure"}}},
+				{"index": {"_id": "4", "status": 404, "error": {"type": "index_not_found_exception", "reason": "no such index"}}}
+			]}`,
+			3,
+		},
+	}
+
+	for _, test := range tests {
+		var r bulkResponse
+
+		if err := json.Unmarshal([]byte(test.body), &r); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		err := r.check()
+
+		if test.failed == 0 {
+			if err != nil {
+				t.Errorf("%s: check() = %s, want nil", test.name, err)
+			}
+
+			continue
+		}
+
+		var bulkErr *BulkError
+
+		if !errors.As(err, &bulkErr) {
+			t.Fatalf("%s: check() = %v, want a BulkError", test.name, err)
+		}
+
+		if bulkErr.Failed != test.failed || bulkErr.Total != len(r.Items) || len(bulkErr.Reasons) != test.failed {
+			t.Errorf("%s: check() = %+v, want %d out of %d failed", test.name, bulkErr, test.failed, len(r.Items))
+		}
+
+		if !strings.Contains(bulkErr.Reasons[0], "index 2: failed to parse field [time_posted] (mapper_parsing_exception)") {
+			t.Errorf("%s: first reason is %q", test.name, bulkErr.Reasons[0])
+		}
+	}
+}
+
+func TestBulkErrorKeepsFiveReasons(t *testing.T) {
+	r := bulkResponse{Errors: true}
+
+	for i := 0; i < 8; i++ {
+		r.Items = append(r.Items, map[string]bulkItemResponse{
+			"index": {ID: "1", Status: 400, Error: &bulkError{Type: "mapper_parsing_exception"}},
+		})
+	}
+
+	var bulkErr *BulkError
+
+	if !errors.As(r.check(), &bulkErr) || bulkErr.Failed != 8 || len(bulkErr.Reasons) != 5 {
+		t.Errorf("check() = %+v, want 8 failures and 5 reasons", bulkErr)
+	}
+}
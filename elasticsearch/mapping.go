@@ -0,0 +1,59 @@
+//Package elasticsearch indexes posts into Elasticsearch
+//or OpenSearch by providing entities and a Service
+package elasticsearch
+
+import "moon/lnx"
+
+//createIndexRequest is the body of an index creation request
+type createIndexRequest struct {
+	Mappings mappings `json:"mappings"`
+}
+
+type mappings struct {
+	Dynamic    string              `json:"dynamic"`
+	Properties map[string]property `json:"properties"`
+}
+
+//property is the mapping of a single field
+type property struct {
+	Type      string `json:"type"`
+	Index     bool   `json:"index"`
+	DocValues *bool  `json:"doc_values,omitempty"`
+}
+
+//fieldTypes maps Lnx field types to Elasticsearch ones
+var fieldTypes = map[string]string{
+	"i64":    "long",
+	"f64":    "double",
+	"date":   "date",
+	"text":   "text",
+	"string": "keyword",
+}
+
+//buildCreateIndexRequest builds a mapping equivalent to the
+//fields of an Lnx index, fast fields being the ones with
+//doc values so they can be sorted and aggregated on
+func buildCreateIndexRequest(fields map[string]lnx.IndexField) createIndexRequest {
+	properties := make(map[string]property, len(fields))
+
+	for name, field := range fields {
+		p := property{
+			Type:  fieldTypes[field.Type],
+			Index: field.Indexed,
+		}
+
+		if p.Type != "text" {
+			fast := field.Fast
+			p.DocValues = &fast
+		}
+
+		properties[name] = p
+	}
+
+	return createIndexRequest{
+		Mappings: mappings{
+			Dynamic:    "strict",
+			Properties: properties,
+		},
+	}
+}
@@ -0,0 +1,272 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"moon/config"
+	"moon/db"
+	"moon/lnx"
+	"moon/sink"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var _ sink.Sink = (*Service)(nil)
+var _ sink.Pinger = (*Service)(nil)
+
+//Service wraps writes and upserts to an Elasticsearch
+//or OpenSearch cluster through the _bulk API
+type Service struct {
+	host     string
+	username string
+	password string
+	client   http.Client
+}
+
+//NewService constructs and returns a Service
+func NewService(conf config.ElasticsearchConfig) *Service {
+	return &Service{
+		host:     fmt.Sprintf("%s:%d", conf.Host, conf.Port),
+		username: conf.Username,
+		password: conf.Password,
+		client: http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+//Upsert indexes an array of posts in a bulk request,
+//deleting hidden posts along the way
+func (s *Service) Upsert(ctx context.Context, posts []db.Post, index string, previousScrape time.Time) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	var b bytes.Buffer
+
+	encoder := json.NewEncoder(&b)
+
+	for i := range posts {
+		target := &bulkTarget{Index: index, ID: strconv.FormatInt(posts[i].PostNumber, 10)}
+
+		if posts[i].Hidden {
+			if err := encoder.Encode(bulkAction{Delete: target}); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := encoder.Encode(bulkAction{Index: target}); err != nil {
+			return err
+		}
+
+		if err := encoder.Encode(lnx.DbPostToLnxPost(&posts[i])); err != nil {
+			return err
+		}
+	}
+
+	if err := s.bulk(ctx, &b); err != nil {
+		return fmt.Errorf("Error upserting posts: %w", err)
+	}
+
+	return nil
+}
+
+//Delete deletes an array of posts from the index
+func (s *Service) Delete(ctx context.Context, posts []db.Post, index string) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	var b bytes.Buffer
+
+	encoder := json.NewEncoder(&b)
+
+	for _, p := range posts {
+		target := &bulkTarget{Index: index, ID: strconv.FormatInt(p.PostNumber, 10)}
+
+		if err := encoder.Encode(bulkAction{Delete: target}); err != nil {
+			return err
+		}
+	}
+
+	if err := s.bulk(ctx, &b); err != nil {
+		return fmt.Errorf("Error deleting posts: %w", err)
+	}
+
+	return nil
+}
+
+//Commit refreshes the index so everything
+//written to it becomes searchable
+func (s *Service) Commit(ctx context.Context, index string) error {
+	resp, err := s.do(ctx, "POST", fmt.Sprintf("/%s/_refresh", index), "", nil)
+
+	if err != nil {
+		return fmt.Errorf("Error refreshing index: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return statusError(resp)
+	}
+
+	return nil
+}
+
+//Rollback is a no-op, as Elasticsearch can't undo bulk writes.
+//A retried pass indexes the same posts under the same _id,
+//overwriting whatever it left behind.
+func (s *Service) Rollback(ctx context.Context, index string) error {
+	return nil
+}
+
+//CreateIndex creates an index for a board with a mapping
+//equivalent to the fields of its schema
+func (s *Service) CreateIndex(ctx context.Context, index string, conf config.BoardConfig) error {
+	schema, err := lnx.NewSchema(conf.Schema)
+
+	if err != nil {
+		return fmt.Errorf("Error building schema for index %s: %w", index, err)
+	}
+
+	b, err := json.Marshal(buildCreateIndexRequest(schema.Fields))
+
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, "PUT", "/"+index, "application/json", bytes.NewReader(b))
+
+	if err != nil {
+		return fmt.Errorf("Error creating index %s: %w", index, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 400 {
+		var errorResponse struct {
+			Error bulkError `json:"error"`
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err == nil && errorResponse.Error.Type == "resource_already_exists_exception" {
+			slog.Info("Index already exists", "sink", "elasticsearch", "index", index)
+			return nil
+		}
+	}
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Error creating index %s: %w", index, statusError(resp))
+	}
+
+	return nil
+}
+
+//DropIndex deletes an index
+func (s *Service) DropIndex(ctx context.Context, index string) error {
+	resp, err := s.do(ctx, "DELETE", "/"+index, "", nil)
+
+	if err != nil {
+		return fmt.Errorf("Error deleting index %s: %w", index, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && resp.StatusCode != 404 {
+		return fmt.Errorf("Error deleting index %s: %w", index, statusError(resp))
+	}
+
+	return nil
+}
+
+//Count returns the number of posts in an index
+func (s *Service) Count(ctx context.Context, index string) (int64, error) {
+	resp, err := s.do(ctx, "GET", fmt.Sprintf("/%s/_count", index), "", nil)
+
+	if err != nil {
+		return 0, fmt.Errorf("Error counting posts in index %s: %w", index, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return 0, fmt.Errorf("Error counting posts in index %s: %w", index, statusError(resp))
+	}
+
+	var countResponse struct {
+		Count int64 `json:"count"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&countResponse); err != nil {
+		return 0, err
+	}
+
+	return countResponse.Count, nil
+}
+
+//bulk sends an NDJSON body to the _bulk endpoint, failing
+//if any of the actions in it fail
+func (s *Service) bulk(ctx context.Context, body io.Reader) error {
+	resp, err := s.do(ctx, "POST", "/_bulk", "application/x-ndjson", body)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return statusError(resp)
+	}
+
+	var bulkResp bulkResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&bulkResp); err != nil {
+		return err
+	}
+
+	return bulkResp.check()
+}
+
+//Ping checks Elasticsearch is available
+func (s *Service) Ping(ctx context.Context) error {
+	resp, err := s.do(ctx, "GET", "/", "", nil)
+
+	if err != nil {
+		return fmt.Errorf("Error reaching Elasticsearch: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Error reaching Elasticsearch: %w", statusError(resp))
+	}
+
+	return nil
+}
+
+func (s *Service) do(ctx context.Context, method string, path string, contentType string, body io.Reader) (*http.Response, error) {
+	r, _ := http.NewRequestWithContext(ctx, method, s.host+path, body)
+
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	if s.username != "" {
+		r.SetBasicAuth(s.username, s.password)
+	}
+
+	return s.client.Do(r)
+}
+
+func statusError(resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("Request received status %s: %s", resp.Status, b)
+}
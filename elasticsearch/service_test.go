@@ -0,0 +1,172 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"moon/config"
+	"moon/db"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+//bulkRequest is what a stand-in cluster received on _bulk
+type bulkRequest struct {
+	contentType string
+	lines       []map[string]json.RawMessage
+}
+
+//newCluster starts a stand-in cluster that answers _bulk
+//requests with the body passed and records them
+func newCluster(t *testing.T, bulkBody string) (*Service, *[]bulkRequest) {
+	requests := make([]bulkRequest, 0)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/_bulk":
+			req := bulkRequest{contentType: r.Header.Get("Content-Type")}
+			scanner := bufio.NewScanner(r.Body)
+
+			for scanner.Scan() {
+				var line map[string]json.RawMessage
+
+				if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+					t.Errorf("Invalid NDJSON line %q: %s", scanner.Text(), err)
+				}
+
+				req.lines = append(req.lines, line)
+			}
+
+			requests = append(requests, req)
+			io.WriteString(w, bulkBody)
+		case r.Method == "PUT" && r.URL.Path == "/post_a":
+			w.WriteHeader(400)
+			io.WriteString(w, `{"error": {"type": "resource_already_exists_exception", "reason": "index [post_a] already exists"}}`)
+		case r.Method == "PUT" && r.URL.Path == "/post_b":
+			w.WriteHeader(400)
+			io.WriteString(w, `{"error": {"type": "mapper_parsing_exception", "reason": "unknown parameter"}}`)
+		case r.Method == "GET" && r.URL.Path == "/post_a/_count":
+			io.WriteString(w, `{"count": 42}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return &Service{host: srv.URL, client: http.Client{Timeout: 5 * time.Second}}, &requests
+}
+
+func TestUpsert(t *testing.T) {
+	s, requests := newCluster(t, `{"errors": false, "items": []}`)
+
+	posts := []db.Post{
+		{Board: "a", PostNumber: 1, TimePosted: time.Unix(0, 0)},
+		{Board: "a", PostNumber: 2, Hidden: true},
+		{Board: "a", PostNumber: 3, TimePosted: time.Unix(0, 0)},
+	}
+
+	if err := s.Upsert(context.Background(), posts, "post_a", time.Time{}); err != nil {
+		t.Fatalf("Upsert() failed: %s", err)
+	}
+
+	if len(*requests) != 1 {
+		t.Fatalf("Sent %d bulk requests, want 1", len(*requests))
+	}
+
+	req := (*requests)[0]
+
+	if req.contentType != "application/x-ndjson" {
+		t.Errorf("Content-Type = %s, want application/x-ndjson", req.contentType)
+	}
+
+	//Every post indexed is an action line followed by the
+	//post, while hidden ones are a lone delete action
+	lines := []struct {
+		action string
+		id     string
+	}{
+		{"index", "1"},
+		{"", "1"},
+		{"delete", "2"},
+		{"index", "3"},
+		{"", "3"},
+	}
+
+	if len(req.lines) != len(lines) {
+		t.Fatalf("Sent %d lines, want %d", len(req.lines), len(lines))
+	}
+
+	for i, line := range lines {
+		if line.action == "" {
+			if string(req.lines[i]["post_number"]) != line.id {
+				t.Errorf("Line %d = %v, want post %s", i, req.lines[i], line.id)
+			}
+
+			continue
+		}
+
+		var target bulkTarget
+
+		if err := json.Unmarshal(req.lines[i][line.action], &target); err != nil || target != (bulkTarget{Index: "post_a", ID: line.id}) {
+			t.Errorf("Line %d = %v, want a %s action for post %s", i, req.lines[i], line.action, line.id)
+		}
+	}
+}
+
+func TestUpsertFailsOnItemErrors(t *testing.T) {
+	s, _ := newCluster(t, `{"errors": true, "items": [
+		{"index": {"_id": "1", "status": 201}},
+		{"index": {"_id": "2", "status": 400, "error": {"type": "mapper_parsing_exception", "reason": "failed to parse"}}}
+	]}`)
+
+	posts := []db.Post{{Board: "a", PostNumber: 1}, {Board: "a", PostNumber: 2}}
+
+	var bulkErr *BulkError
+
+	if err := s.Upsert(context.Background(), posts, "post_a", time.Time{}); !errors.As(err, &bulkErr) || bulkErr.Failed != 1 {
+		t.Errorf("Upsert() = %v, want one failed action", err)
+	}
+}
+
+func TestDeleteIgnoresMissingPosts(t *testing.T) {
+	s, requests := newCluster(t, `{"errors": true, "items": [
+		{"delete": {"_id": "1", "status": 404, "error": {"type": "not_found", "reason": "not found"}}}
+	]}`)
+
+	if err := s.Delete(context.Background(), []db.Post{{Board: "a", PostNumber: 1}}, "post_a"); err != nil {
+		t.Errorf("Delete() = %s, want nil", err)
+	}
+
+	if len(*requests) != 1 || len((*requests)[0].lines) != 1 || (*requests)[0].lines[0]["delete"] == nil {
+		t.Errorf("Delete() sent %+v, want a single delete action", *requests)
+	}
+}
+
+func TestCreateIndex(t *testing.T) {
+	s, _ := newCluster(t, "")
+
+	if err := s.CreateIndex(context.Background(), "post_a", config.BoardConfig{Name: "a"}); err != nil {
+		t.Errorf("CreateIndex() on an existing index = %s, want nil", err)
+	}
+
+	if err := s.CreateIndex(context.Background(), "post_b", config.BoardConfig{Name: "b"}); err == nil {
+		t.Error("CreateIndex() with a rejected mapping succeeded")
+	}
+}
+
+func TestCount(t *testing.T) {
+	s, _ := newCluster(t, "")
+
+	if count, err := s.Count(context.Background(), "post_a"); err != nil || count != 42 {
+		t.Errorf("Count() = %d, %v, want 42", count, err)
+	}
+
+	if _, err := s.Count(context.Background(), "post_c"); err == nil {
+		t.Error("Count() on a missing index succeeded")
+	}
+}
@@ -0,0 +1,220 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"moon/db"
+	"sort"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+//ErrUnknownBoard is returned when operating
+//on a board that isn't configured
+var ErrUnknownBoard = errors.New("Board is not configured")
+
+//JobStatus is the state of a running job, syncing
+//a board into either its live index or a rebuild
+type JobStatus struct {
+	Sink       string     `json:"sink"`
+	Board      string     `json:"board"`
+	Rebuild    string     `json:"rebuild,omitempty"`
+	Paused     bool       `json:"paused"`
+	GaveUp     bool       `json:"gave_up"`
+	Failures   int        `json:"failures"`
+	LastError  string     `json:"last_error,omitempty"`
+	LastFailed *time.Time `json:"last_failed,omitempty"`
+}
+
+//Jobs returns the status of every running job, and of
+//those given up on after failing too many times in a row
+func (ix *Indexer) Jobs() []JobStatus {
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+
+	statuses := make([]JobStatus, 0, len(ix.active))
+
+	for j := range ix.active {
+		status := JobStatus{
+			Sink:    j.sink.Name,
+			Board:   j.board.Name,
+			Rebuild: j.shadow,
+			Paused:  ix.paused[j.board.Name],
+		}
+
+		j.state.Lock()
+
+		status.Failures = j.failures
+		status.GaveUp = j.gaveUp
+
+		if j.lastError != nil {
+			lastFailed := j.lastFailed
+			status.LastError = j.lastError.Error()
+			status.LastFailed = &lastFailed
+		}
+
+		j.state.Unlock()
+
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(a, b int) bool {
+		if statuses[a].Board != statuses[b].Board {
+			return statuses[a].Board < statuses[b].Board
+		}
+
+		if statuses[a].Sink != statuses[b].Sink {
+			return statuses[a].Sink < statuses[b].Sink
+		}
+
+		return statuses[a].Rebuild < statuses[b].Rebuild
+	})
+
+	return statuses
+}
+
+//Sync triggers a board so it gets synced right away
+func (ix *Indexer) Sync(board string) error {
+	if !ix.hasBoard(board) {
+		return ErrUnknownBoard
+	}
+
+	ix.Trigger(board)
+
+	return nil
+}
+
+//Pause stops a board from being synced into any sink
+//once the passes in progress are done, until resumed.
+//Boards are no longer paused after a restart.
+func (ix *Indexer) Pause(board string) error {
+	if !ix.hasBoard(board) {
+		return ErrUnknownBoard
+	}
+
+	ix.mutex.Lock()
+	ix.paused[board] = true
+	ix.mutex.Unlock()
+
+	return nil
+}
+
+//Resume syncs a paused board again right away
+func (ix *Indexer) Resume(board string) error {
+	if !ix.hasBoard(board) {
+		return ErrUnknownBoard
+	}
+
+	ix.mutex.Lock()
+	delete(ix.paused, board)
+	ix.mutex.Unlock()
+
+	ix.Trigger(board)
+
+	return nil
+}
+
+//Paused reports whether a board is paused
+func (ix *Indexer) Paused(board string) bool {
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+
+	return ix.paused[board]
+}
+
+//Reindex requests a rebuild of the index of a board in
+//every sink and triggers it so it starts right away
+func (ix *Indexer) Reindex(ctx context.Context, board string) error {
+	if !ix.hasBoard(board) {
+		return ErrUnknownBoard
+	}
+
+	if err := RequestReindex(ctx, ix.pg, board, ix.sinkNames(board)); err != nil {
+		return err
+	}
+
+	ix.Trigger(board)
+
+	return nil
+}
+
+//RequestReindex leaves a request to rebuild the index of
+//a board in every sink passed, which Moon takes before the
+//next pass over the board
+func RequestReindex(ctx context.Context, pg bun.IDB, board string, sinks []string) error {
+	requests := make([]db.ReindexRequest, 0, len(sinks))
+
+	for _, name := range sinks {
+		requests = append(requests, db.ReindexRequest{Sink: name, Board: board})
+	}
+
+	_, err := pg.NewInsert().
+		Model(&requests).
+		Returning("NULL").
+		Exec(ctx)
+
+	return err
+}
+
+//DeadLetters returns the dead letters of a board in every
+//sink, or only of the posts passed if any are
+func (ix *Indexer) DeadLetters(ctx context.Context, board string, postNumbers []int64) ([]db.DeadLetter, error) {
+	if !ix.hasBoard(board) {
+		return nil, ErrUnknownBoard
+	}
+
+	return DeadLetters(ctx, ix.pg, board, ix.sinkNames(board), postNumbers)
+}
+
+//RetryDeadLetters requests the dead letters of a board, or
+//only of the posts passed if any are, to be retried and
+//triggers the board so they are right away
+func (ix *Indexer) RetryDeadLetters(ctx context.Context, board string, postNumbers []int64) (int64, error) {
+	if !ix.hasBoard(board) {
+		return 0, ErrUnknownBoard
+	}
+
+	n, err := RetryDeadLetters(ctx, ix.pg, board, ix.sinkNames(board), postNumbers)
+
+	if err != nil {
+		return 0, err
+	}
+
+	ix.Trigger(board)
+
+	return n, nil
+}
+
+//DiscardDeadLetters deletes the dead letters of a board,
+//or only of the posts passed if any are
+func (ix *Indexer) DiscardDeadLetters(ctx context.Context, board string, postNumbers []int64) (int64, error) {
+	if !ix.hasBoard(board) {
+		return 0, ErrUnknownBoard
+	}
+
+	return DiscardDeadLetters(ctx, ix.pg, board, ix.sinkNames(board), postNumbers)
+}
+
+//sinkNames returns the names of the sinks a board is synced into
+func (ix *Indexer) sinkNames(board string) []string {
+	sinks := make([]string, 0, len(ix.jobs))
+
+	for _, j := range ix.jobs {
+		if j.board.Name == board {
+			sinks = append(sinks, j.sink.Name)
+		}
+	}
+
+	return sinks
+}
+
+func (ix *Indexer) hasBoard(board string) bool {
+	for _, b := range ix.boards {
+		if b.Name == board {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,230 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"moon/db"
+	"moon/metrics"
+	"moon/sink"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+//setAside records a post the sink rejected for good
+type setAside func(post db.Post, cause error) error
+
+//upsert upserts posts into an index, splitting batches the
+//sink rejects in halves until the posts responsible are found.
+//Those are handed to setAside, so the rest of the board keeps
+//being synced.
+func (ix *Indexer) upsert(ctx context.Context, j *job, index string, posts []db.Post, previousScrape time.Time, setAside setAside) error {
+	return ix.settle(ctx, j, index, posts, previousScrape, j.sink.Upsert(ctx, posts, index, previousScrape), setAside)
+}
+
+//settle handles the outcome of upserting posts, bisecting them
+//down to single posts if the sink rejected them and setting
+//aside the ones still rejected on their own. Errors other than
+//rejections, such as those about the sink or the index rather
+//than the posts sent, fail the pass as they are.
+func (ix *Indexer) settle(ctx context.Context, j *job, index string, posts []db.Post, previousScrape time.Time, err error, setAside setAside) error {
+	if err == nil || !errors.Is(err, sink.ErrRejected) {
+		return err
+	}
+
+	if len(posts) == 1 {
+		return setAside(posts[0], err)
+	}
+
+	half := len(posts) / 2
+	first, second := posts[:half], posts[half:]
+
+	firstErr := j.sink.Upsert(ctx, first, index, previousScrape)
+
+	if err := ix.settle(ctx, j, index, first, previousScrape, firstErr, setAside); err != nil {
+		return err
+	}
+
+	secondErr := j.sink.Upsert(ctx, second, index, previousScrape)
+
+	return ix.settle(ctx, j, index, second, previousScrape, secondErr, setAside)
+}
+
+//deadLetters sets aside the posts rejected in an index as
+//dead letters, in the same transaction as the cursor
+func (ix *Indexer) deadLetters(ctx context.Context, tx bun.Tx, j *job, index string) setAside {
+	return func(post db.Post, cause error) error {
+		return ix.deadLetter(ctx, tx, j, index, post, cause)
+	}
+}
+
+//deadLetter sets aside a post the sink rejected, replacing
+//any dead letter left for it in the same index before
+func (ix *Indexer) deadLetter(ctx context.Context, tx bun.Tx, j *job, index string, post db.Post, cause error) error {
+	payload, err := json.Marshal(&post)
+
+	if err != nil {
+		return err
+	}
+
+	deadLetter := db.DeadLetter{
+		Sink:       j.sink.Name,
+		Board:      j.board.Name,
+		PostNumber: post.PostNumber,
+		IndexName:  index,
+		Error:      cause.Error(),
+		Payload:    payload,
+	}
+
+	_, err = tx.NewInsert().
+		Model(&deadLetter).
+		On("CONFLICT (sink, board, index_name, post_number) DO UPDATE").
+		Set("error = EXCLUDED.error").
+		Set("payload = EXCLUDED.payload").
+		Set("created_at = now()").
+		Set("retry_requested_at = NULL").
+		Returning("NULL").
+		Exec(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	j.logger().Warn("Setting rejected post aside", "index", index, "post_number", post.PostNumber, "error", cause)
+	metrics.DeadLetters.WithLabelValues(j.sink.Name, j.board.Name).Inc()
+
+	return nil
+}
+
+//retryDeadLetters takes the dead letters of the index a retry
+//was requested for and upserts the posts they were left for
+//again, as they are in the database now. Posts rejected once
+//more are set aside again.
+func (ix *Indexer) retryDeadLetters(ctx context.Context, tx bun.Tx, j *job, index string, previousScrape time.Time) error {
+	var postNumbers []int64
+
+	_, err := tx.NewDelete().
+		Model((*db.DeadLetter)(nil)).
+		Where("sink = ?", j.sink.Name).
+		Where("board = ?", j.board.Name).
+		Where("index_name = ?", index).
+		Where("retry_requested_at IS NOT NULL").
+		Returning("post_number").
+		Exec(ctx, &postNumbers)
+
+	if err != nil || len(postNumbers) == 0 {
+		return err
+	}
+
+	j.logger().Info("Retrying dead letters", "index", index, "posts", len(postNumbers))
+
+	var posts []db.Post
+
+	err = tx.NewSelect().
+		Model(&posts).
+		Where("board = ?", j.board.Name).
+		Where("post_number IN (?)", bun.In(postNumbers)).
+		Order("post_number ASC").
+		For("SHARE").
+		Scan(ctx)
+
+	if err != nil || len(posts) == 0 {
+		return err
+	}
+
+	return ix.upsert(ctx, j, index, posts, previousScrape, ix.deadLetters(ctx, tx, j, index))
+}
+
+//DeadLetters returns the dead letters of a board in every
+//sink passed, or only of the posts passed if any are
+func DeadLetters(ctx context.Context, pg bun.IDB, board string, sinks []string, postNumbers []int64) ([]db.DeadLetter, error) {
+	deadLetters := make([]db.DeadLetter, 0)
+
+	q := pg.NewSelect().
+		Model(&deadLetters).
+		Where("board = ?", board).
+		Where("sink IN (?)", bun.In(sinks)).
+		Order("sink ASC", "post_number ASC")
+
+	if len(postNumbers) > 0 {
+		q = q.Where("post_number IN (?)", bun.In(postNumbers))
+	}
+
+	if err := q.Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	return deadLetters, nil
+}
+
+//RetryDeadLetters requests the dead letters of a board in
+//every sink passed, or only of the posts passed if any are,
+//to be retried on the next pass over the board, returning
+//how many were
+func RetryDeadLetters(ctx context.Context, pg bun.IDB, board string, sinks []string, postNumbers []int64) (int64, error) {
+	q := pg.NewUpdate().
+		Model((*db.DeadLetter)(nil)).
+		Set("retry_requested_at = now()").
+		Where("board = ?", board).
+		Where("sink IN (?)", bun.In(sinks))
+
+	if len(postNumbers) > 0 {
+		q = q.Where("post_number IN (?)", bun.In(postNumbers))
+	}
+
+	result, err := q.Exec(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+//DiscardDeadLetters deletes the dead letters of a board in
+//every sink passed, or only of the posts passed if any are,
+//returning how many were
+func DiscardDeadLetters(ctx context.Context, pg bun.IDB, board string, sinks []string, postNumbers []int64) (int64, error) {
+	q := pg.NewDelete().
+		Model((*db.DeadLetter)(nil)).
+		Where("board = ?", board).
+		Where("sink IN (?)", bun.In(sinks))
+
+	if len(postNumbers) > 0 {
+		q = q.Where("post_number IN (?)", bun.In(postNumbers))
+	}
+
+	result, err := q.Exec(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+//ParsePostNumbers parses a comma separated list of post numbers
+func ParsePostNumbers(s string) ([]int64, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(s, ",")
+	postNumbers := make([]int64, 0, len(parts))
+
+	for _, part := range parts {
+		n, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid post number %s", part)
+		}
+
+		postNumbers = append(postNumbers, n)
+	}
+
+	return postNumbers, nil
+}
@@ -0,0 +1,196 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"moon/db"
+	"moon/sink"
+	"testing"
+	"time"
+)
+
+func TestParsePostNumbers(t *testing.T) {
+	tests := []struct {
+		s           string
+		postNumbers string
+		err         bool
+	}{
+		{"", "[]", false},
+		{"1", "[1]", false},
+		{"1,2, 3 ,40000000000", "[1 2 3 40000000000]", false},
+		{"1,,2", "", true},
+		{"1,a", "", true},
+		{"1.5", "", true},
+	}
+
+	for _, test := range tests {
+		postNumbers, err := ParsePostNumbers(test.s)
+
+		if test.err {
+			if err == nil {
+				t.Errorf("ParsePostNumbers(%q) = %v, want an error", test.s, postNumbers)
+			}
+
+			continue
+		}
+
+		if err != nil || fmt.Sprint(postNumbers) != test.postNumbers {
+			t.Errorf("ParsePostNumbers(%q) = %v, %v, want %s", test.s, postNumbers, err, test.postNumbers)
+		}
+	}
+}
+
+func settlePosts(postNumbers ...int64) []db.Post {
+	posts := make([]db.Post, 0, len(postNumbers))
+
+	for _, postNumber := range postNumbers {
+		posts = append(posts, db.Post{Board: "a", PostNumber: postNumber})
+	}
+
+	return posts
+}
+
+//setAsideInto returns a setAside keeping the posts passed to
+//it in postNumbers, along with the errors they were rejected with
+func setAsideInto(postNumbers *[]int64, causes *[]error) setAside {
+	return func(post db.Post, cause error) error {
+		*postNumbers = append(*postNumbers, post.PostNumber)
+		*causes = append(*causes, cause)
+
+		return nil
+	}
+}
+
+func TestSettle(t *testing.T) {
+	ctx := context.Background()
+	rejected := fmt.Errorf("Error upserting posts: %w", sink.ErrRejected)
+
+	t.Run("passes through other outcomes", func(t *testing.T) {
+		s := newFakeSink()
+		ix := newTestIndexer(map[string]sink.Sink{"lnx": s}, "a")
+		unreachable := errors.New("Connection refused")
+
+		var setAsides []int64
+		var causes []error
+
+		if err := ix.settle(ctx, ix.jobs[0], "post_a", settlePosts(1, 2), time.Time{}, nil, setAsideInto(&setAsides, &causes)); err != nil {
+			t.Errorf("settle() = %s, want nil", err)
+		}
+
+		if err := ix.settle(ctx, ix.jobs[0], "post_a", settlePosts(1, 2), time.Time{}, unreachable, setAsideInto(&setAsides, &causes)); err != unreachable {
+			t.Errorf("settle() = %v, want %s", err, unreachable)
+		}
+
+		if len(s.upserts) != 0 || len(setAsides) != 0 {
+			t.Errorf("settle() upserted %v and set aside %v, want nothing", s.upserts, setAsides)
+		}
+	})
+
+	t.Run("bisects batches rejected as a whole", func(t *testing.T) {
+		s := newFakeSink()
+		s.upsertErr = func(posts []db.Post) error {
+			if len(posts) > 2 {
+				return rejected
+			}
+
+			return nil
+		}
+
+		ix := newTestIndexer(map[string]sink.Sink{"lnx": s}, "a")
+
+		var setAsides []int64
+		var causes []error
+
+		if err := ix.settle(ctx, ix.jobs[0], "post_a", settlePosts(1, 2, 3, 4), time.Time{}, rejected, setAsideInto(&setAsides, &causes)); err != nil {
+			t.Fatalf("settle() = %s, want nil", err)
+		}
+
+		if fmt.Sprint(s.upserts) != "[[1 2] [3 4]]" {
+			t.Errorf("settle() upserted %v, want [[1 2] [3 4]]", s.upserts)
+		}
+
+		if count, _ := s.Count(ctx, "post_a"); count != 4 || len(setAsides) != 0 {
+			t.Errorf("Index holds %d posts with %v set aside, want 4 and none", count, setAsides)
+		}
+	})
+
+	t.Run("fails on errors met while bisecting", func(t *testing.T) {
+		unreachable := errors.New("Connection refused")
+
+		s := newFakeSink()
+		s.upsertErr = func(posts []db.Post) error {
+			if len(posts) == 2 {
+				return unreachable
+			}
+
+			return rejected
+		}
+
+		ix := newTestIndexer(map[string]sink.Sink{"lnx": s}, "a")
+
+		var setAsides []int64
+		var causes []error
+
+		if err := ix.settle(ctx, ix.jobs[0], "post_a", settlePosts(1, 2, 3, 4), time.Time{}, rejected, setAsideInto(&setAsides, &causes)); err != unreachable {
+			t.Errorf("settle() = %v, want %s", err, unreachable)
+		}
+
+		if len(setAsides) != 0 {
+			t.Errorf("settle() set aside %v, want nothing", setAsides)
+		}
+	})
+}
+
+func TestIndexBatch(t *testing.T) {
+	ctx := context.Background()
+	rejected := fmt.Errorf("Error upserting posts: %w", sink.ErrRejected)
+
+	//Posts 2 and 7 end up in different halves, rejected with
+	//the very same message as would happen with a field missing
+	s := newFakeSink()
+	s.upsertErr = func(posts []db.Post) error {
+		for _, p := range posts {
+			if p.PostNumber == 2 || p.PostNumber == 7 {
+				return rejected
+			}
+		}
+
+		return nil
+	}
+
+	ix := newTestIndexer(map[string]sink.Sink{"lnx": s}, "a")
+
+	posts := settlePosts(1, 2, 3, 4, 5, 6, 7, 8)
+
+	for i := range posts {
+		posts[i].LastModified = time.Unix(int64(i), 0)
+	}
+
+	tracker := db.IndexTracker{Sink: "lnx", Board: "a", IndexName: "post_a"}
+
+	var setAsides []int64
+	var causes []error
+
+	if err := ix.indexBatch(ctx, ix.jobs[0], &tracker, posts, time.Time{}, setAsideInto(&setAsides, &causes)); err != nil {
+		t.Fatalf("indexBatch() = %s, want nil", err)
+	}
+
+	if fmt.Sprint(setAsides) != "[2 7]" {
+		t.Errorf("indexBatch() set aside %v, want [2 7]", setAsides)
+	}
+
+	for _, cause := range causes {
+		if cause != rejected {
+			t.Errorf("Post set aside for %v, want %s", cause, rejected)
+		}
+	}
+
+	if count, _ := s.Count(ctx, "post_a"); count != 6 {
+		t.Errorf("Index holds %d posts, want 6", count)
+	}
+
+	if tracker.PostNumber != 8 || !tracker.LastModified.Equal(posts[7].LastModified) {
+		t.Errorf("Cursor at post %d, want it past the batch at post 8", tracker.PostNumber)
+	}
+}
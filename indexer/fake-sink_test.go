@@ -0,0 +1,149 @@
+package indexer
+
+import (
+	"context"
+	"moon/config"
+	"moon/db"
+	"moon/sink"
+	"sync"
+	"time"
+)
+
+var _ sink.Sink = (*fakeSink)(nil)
+
+//fakeSink is a sink keeping posts in memory, so the indexer
+//can be tested without a search backend. Upserts fail with
+//whatever upsertErr returns for the posts sent, if set.
+type fakeSink struct {
+	upsertErr func(posts []db.Post) error
+	countErr  error
+
+	mutex   sync.Mutex
+	indexes map[string]map[int64]db.Post
+	upserts [][]int64
+}
+
+func newFakeSink() *fakeSink {
+	return &fakeSink{indexes: make(map[string]map[int64]db.Post)}
+}
+
+func (s *fakeSink) CreateIndex(ctx context.Context, index string, conf config.BoardConfig) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.indexes[index] == nil {
+		s.indexes[index] = make(map[int64]db.Post)
+	}
+
+	return nil
+}
+
+func (s *fakeSink) DropIndex(ctx context.Context, index string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.indexes, index)
+
+	return nil
+}
+
+func (s *fakeSink) Count(ctx context.Context, index string) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.countErr != nil {
+		return 0, s.countErr
+	}
+
+	return int64(len(s.indexes[index])), nil
+}
+
+func (s *fakeSink) Upsert(ctx context.Context, posts []db.Post, index string, previousScrape time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	postNumbers := make([]int64, 0, len(posts))
+
+	for _, p := range posts {
+		postNumbers = append(postNumbers, p.PostNumber)
+	}
+
+	s.upserts = append(s.upserts, postNumbers)
+
+	if s.upsertErr != nil {
+		if err := s.upsertErr(posts); err != nil {
+			return err
+		}
+	}
+
+	if s.indexes[index] == nil {
+		s.indexes[index] = make(map[int64]db.Post)
+	}
+
+	for _, p := range posts {
+		if p.Hidden {
+			delete(s.indexes[index], p.PostNumber)
+		} else {
+			s.indexes[index][p.PostNumber] = p
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeSink) Delete(ctx context.Context, posts []db.Post, index string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, p := range posts {
+		delete(s.indexes[index], p.PostNumber)
+	}
+
+	return nil
+}
+
+func (s *fakeSink) Commit(ctx context.Context, index string) error {
+	return nil
+}
+
+func (s *fakeSink) Rollback(ctx context.Context, index string) error {
+	return nil
+}
+
+//fakeProber is a fakeSink that can be probed
+type fakeProber struct {
+	*fakeSink
+	probed []string
+}
+
+func (s *fakeProber) Probe(ctx context.Context, index string) error {
+	s.probed = append(s.probed, index)
+	return nil
+}
+
+//fakeSchemaless is a fakeSink ignoring schemas
+type fakeSchemaless struct {
+	*fakeSink
+}
+
+func (s *fakeSchemaless) Schemaless() bool {
+	return true
+}
+
+//newTestIndexer builds an indexer syncing the boards passed
+//into the sinks passed, without a database
+func newTestIndexer(sinks map[string]sink.Sink, boards ...string) *Indexer {
+	conf := config.Config{}
+
+	for _, board := range boards {
+		conf.Boards = append(conf.Boards, config.BoardConfig{Name: board})
+	}
+
+	named := make([]sink.Named, 0, len(sinks))
+
+	for name, s := range sinks {
+		named = append(named, sink.Named{Sink: s, Name: name})
+	}
+
+	return NewIndexer(conf, nil, named)
+}
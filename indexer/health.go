@@ -0,0 +1,92 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"moon/db"
+	"moon/sink"
+	"time"
+)
+
+//Healthy returns an error if a pass hasn't moved forward
+//in longer than timeout, which means it's stuck
+func (ix *Indexer) Healthy(timeout time.Duration) error {
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+
+	for j := range ix.active {
+		j.state.Lock()
+		progress := j.progress
+		j.state.Unlock()
+
+		if !progress.IsZero() && time.Since(progress) > timeout {
+			return fmt.Errorf("Board %s in %s hasn't moved forward since %s", j.board.Name, j.name(), progress.Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
+
+//Ready returns an error unless Setup is done, no board was
+//given up on, Postgres can be reached and the live index of
+//every board exists in every sink
+func (ix *Indexer) Ready(ctx context.Context) error {
+	ix.mutex.Lock()
+	ready := ix.ready
+	ix.mutex.Unlock()
+
+	if !ready {
+		return errors.New("Indexes are still being set up")
+	}
+
+	for _, j := range ix.jobs {
+		if j.givenUp() {
+			return fmt.Errorf("Gave up on board %s in %s after too many failures", j.board.Name, j.sink.Name)
+		}
+	}
+
+	if err := ix.pg.PingContext(ctx); err != nil {
+		return fmt.Errorf("Error reaching Postgres: %w", err)
+	}
+
+	var aliases []db.IndexAlias
+
+	if err := ix.pg.NewSelect().Model(&aliases).Scan(ctx); err != nil {
+		return fmt.Errorf("Error reading index aliases: %w", err)
+	}
+
+	live := make(map[[2]string]string, len(aliases))
+
+	for _, alias := range aliases {
+		live[[2]string{alias.Sink, alias.Board}] = alias.IndexName
+	}
+
+	for _, j := range ix.jobs {
+		index, ok := live[[2]string{j.sink.Name, j.board.Name}]
+
+		if !ok {
+			return fmt.Errorf("Board %s has no index in %s", j.board.Name, j.sink.Name)
+		}
+
+		if err := probe(ctx, j.sink, index); err != nil {
+			return fmt.Errorf("Error reaching index %s in %s: %w", index, j.sink.Name, err)
+		}
+	}
+
+	return nil
+}
+
+//probe checks an index of a sink can be reached, counting
+//its posts for sinks that can't do it any cheaper
+func probe(ctx context.Context, s sink.Named, index string) error {
+	if prober, ok := s.Sink.(sink.Prober); ok {
+		return prober.Probe(ctx, index)
+	}
+
+	if _, err := s.Count(ctx, index); err != nil && !errors.Is(err, sink.ErrUnsupported) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,278 @@
+package indexer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"moon/db"
+	"moon/metrics"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+//indexBoard syncs a board into an index of a sink up to a
+//few seconds ago. Posts are locked FOR SHARE so writers have
+//to wait for the pass, while passes of the same board into
+//other sinks or indexes don't. If ctx is cancelled halfway
+//through, the progress made so far is checkpointed, or rolled
+//back if that is not possible, and nil is returned as long as
+//that could be done cleanly.
+func (ix *Indexer) indexBoard(ctx context.Context, j *job) error {
+	start := time.Now()
+	index := j.shadow
+
+	if index == "" {
+		j.live.Lock()
+		defer j.live.Unlock()
+
+		alias := db.IndexAlias{Sink: j.sink.Name, Board: j.board.Name}
+
+		if err := ix.pg.NewSelect().Model(&alias).WherePK().Scan(ctx); err != nil {
+			return ix.stopped(ctx, err)
+		}
+
+		index = alias.IndexName
+	}
+
+	j.advance()
+	defer j.finish()
+
+	dbPosts := make([]db.Post, 0, ix.batchSize)
+	logger := j.logger().With("index", index)
+
+	logger.Info("Indexing board")
+
+	maxTime := time.Now().Add(-5 * time.Second)
+
+	//The transaction outlives ctx, which would otherwise roll it
+	//back on shutdown before the progress made could be checkpointed.
+	//Queries are still cancelled with ctx one by one.
+	tx, err := ix.pg.BeginTx(context.WithoutCancel(ctx), &sql.TxOptions{})
+
+	if err != nil {
+		return ix.stopped(ctx, err)
+	}
+
+	indexTracker := db.IndexTracker{}
+
+	err = tx.NewSelect().
+		Model(&indexTracker).
+		Where("sink = ?", j.sink.Name).
+		Where("board = ?", j.board.Name).
+		Where("index_name = ?", index).
+		Scan(ctx)
+
+	if err != nil {
+		tx.Rollback()
+		return ix.stopped(ctx, err)
+	}
+
+	if err := j.sink.Rollback(ctx, index); err != nil {
+		tx.Rollback()
+		return ix.stopped(ctx, err)
+	}
+
+	metrics.SetTracker(j.sink.Name, j.board.Name, index, indexTracker.LastModified)
+
+	previousScrape := indexTracker.LastModified
+
+	if err := ix.retryDeadLetters(ctx, tx, j, index, previousScrape); err != nil {
+		return ix.abort(ctx, tx, j, index, err)
+	}
+
+	batches := 0
+	posts := 0
+	lastCheckpoint := time.Now()
+
+	for {
+		if ctx.Err() != nil {
+			logger.Info("Checkpointing board before shutting down")
+
+			shutdownCtx, cancel := shutdownContext()
+			defer cancel()
+
+			if err := ix.checkpoint(shutdownCtx, tx, j, &indexTracker); err != nil {
+				return ix.abort(ctx, tx, j, index, err)
+			}
+
+			return nil
+		}
+
+		batchStart := time.Now()
+		dbPosts = dbPosts[0:0]
+
+		err := tx.NewSelect().
+			Model(&dbPosts).
+			Where("board = ?", j.board.Name).
+			Where("last_modified < ?", maxTime).
+			Where("(last_modified, post_number) > (?, ?)", indexTracker.LastModified, indexTracker.PostNumber).
+			Order("last_modified ASC", "post_number ASC").
+			Limit(ix.batchSize).
+			For("SHARE").
+			Scan(ctx)
+
+		if err != nil {
+			return ix.abort(ctx, tx, j, index, err)
+		}
+
+		if len(dbPosts) == 0 {
+			break
+		}
+
+		from := indexTracker
+
+		if err := ix.indexBatch(ctx, j, &indexTracker, dbPosts, previousScrape, ix.deadLetters(ctx, tx, j, index)); err != nil {
+			return ix.abort(ctx, tx, j, index, err)
+		}
+
+		countBatch(j, dbPosts, batchStart)
+		j.advance()
+
+		logger.Debug("Indexed batch",
+			"from", from.LastModified,
+			"from_post", from.PostNumber,
+			"to", indexTracker.LastModified,
+			"to_post", indexTracker.PostNumber,
+			"size", len(dbPosts),
+			"duration", time.Since(batchStart),
+		)
+
+		batches++
+		posts += len(dbPosts)
+
+		if ix.shouldCheckpoint(batches, lastCheckpoint) {
+			logger.Debug("Checkpointing board", "last_modified", indexTracker.LastModified, "post_number", indexTracker.PostNumber)
+
+			if err := ix.checkpoint(ctx, tx, j, &indexTracker); err != nil {
+				return ix.abort(ctx, tx, j, index, err)
+			}
+
+			tx, err = ix.pg.BeginTx(context.WithoutCancel(ctx), &sql.TxOptions{})
+
+			if err != nil {
+				return ix.stopped(ctx, err)
+			}
+
+			batches = 0
+			lastCheckpoint = time.Now()
+		}
+	}
+
+	if err := ix.checkpoint(ctx, tx, j, &indexTracker); err != nil {
+		return ix.abort(ctx, tx, j, index, err)
+	}
+
+	metrics.PassDuration.WithLabelValues(j.sink.Name, j.board.Name, index).Set(time.Since(start).Seconds())
+
+	logger.Info("Indexed board",
+		"posts", posts,
+		"last_modified", indexTracker.LastModified,
+		"duration", time.Since(start),
+	)
+
+	return nil
+}
+
+//indexBatch upserts a batch of posts into the index of the
+//tracker and moves its cursor past the last of them, posts
+//set aside included
+func (ix *Indexer) indexBatch(ctx context.Context, j *job, indexTracker *db.IndexTracker, dbPosts []db.Post, previousScrape time.Time, setAside setAside) error {
+	if err := ix.upsert(ctx, j, indexTracker.IndexName, dbPosts, previousScrape, setAside); err != nil {
+		return err
+	}
+
+	lastPost := dbPosts[len(dbPosts)-1]
+
+	indexTracker.LastModified = lastPost.LastModified
+	indexTracker.PostNumber = lastPost.PostNumber
+
+	return nil
+}
+
+//countBatch records the metrics of a batch indexed
+func countBatch(j *job, dbPosts []db.Post, start time.Time) {
+	hidden := 0
+
+	for i := range dbPosts {
+		if dbPosts[i].Hidden {
+			hidden++
+		}
+	}
+
+	metrics.PostsUpserted.WithLabelValues(j.sink.Name, j.board.Name).Add(float64(len(dbPosts) - hidden))
+	metrics.PostsDeleted.WithLabelValues(j.sink.Name, j.board.Name).Add(float64(hidden))
+	metrics.BatchDuration.WithLabelValues(j.sink.Name, j.board.Name).Observe(time.Since(start).Seconds())
+}
+
+//shouldCheckpoint reports whether enough batches or time have
+//gone by since the last checkpoint. With neither setting configured
+//boards are only committed once the whole pass is done.
+func (ix *Indexer) shouldCheckpoint(batches int, lastCheckpoint time.Time) bool {
+	if ix.checkpointBatches > 0 && batches >= ix.checkpointBatches {
+		return true
+	}
+
+	return ix.checkpointInterval > 0 && time.Since(lastCheckpoint) >= ix.checkpointInterval
+}
+
+//checkpoint persists the tracker, commits the sink and then
+//commits the transaction, releasing the row locks held on every
+//post scanned so far. The tracker goes first so the sink is only
+//committed once the transaction is known to still be usable.
+func (ix *Indexer) checkpoint(ctx context.Context, tx bun.Tx, j *job, indexTracker *db.IndexTracker) error {
+	_, err := tx.NewUpdate().
+		Model(indexTracker).
+		WherePK().
+		Returning("NULL").
+		Exec(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err := j.sink.Commit(ctx, indexTracker.IndexName); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	metrics.SetTracker(j.sink.Name, j.board.Name, indexTracker.IndexName, indexTracker.LastModified)
+
+	return nil
+}
+
+//abort rolls back both the transaction and the sink
+//after cause made the current pass fail
+func (ix *Indexer) abort(ctx context.Context, tx bun.Tx, j *job, index string, cause error) error {
+	tx.Rollback()
+
+	rollbackCtx, cancel := shutdownContext()
+	defer cancel()
+
+	if err := j.sink.Rollback(rollbackCtx, index); err != nil {
+		return fmt.Errorf("%s (rolling back sink: %w)", cause, err)
+	}
+
+	return ix.stopped(ctx, cause)
+}
+
+//stopped swallows errors caused by a shutdown, which are
+//expected as every query and request is cancelled with ctx
+func (ix *Indexer) stopped(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		slog.Info("Interrupted by shutdown", "error", err)
+		return nil
+	}
+
+	return err
+}
+
+//shutdownContext returns a context for the work that
+//still has to be done once Moon has been asked to stop
+func shutdownContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 30*time.Second)
+}
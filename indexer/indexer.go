@@ -0,0 +1,371 @@
+//Package indexer keeps search indexes synced up
+//with the posts in the database
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"moon/config"
+	"moon/db"
+	"moon/lnx"
+	"moon/sink"
+	"sync"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+//Indexer syncs every configured board to every sink,
+//running each board and sink pair in its own goroutine
+type Indexer struct {
+	pg            *bun.DB
+	jobs          []*job
+	boards        []config.BoardConfig
+	batchSize     int
+	napTime       time.Duration
+	semaphore     chan struct{}
+	listenChannel string
+	debounce      time.Duration
+
+	checkpointBatches  int
+	checkpointInterval time.Duration
+
+	maxFailures int
+	backoffBase time.Duration
+	backoffMax  time.Duration
+
+	schemaDrift string
+	rebuilds    chan *job
+
+	//pass runs a single pass of a job, which is indexPass
+	//unless replaced to run jobs without a database
+	pass func(ctx context.Context, j *job) error
+
+	mutex  sync.Mutex
+	active map[*job]bool
+	paused map[string]bool
+	ready  bool
+}
+
+//NewIndexer constructs and returns an Indexer
+func NewIndexer(conf config.Config, pg *bun.DB, sinks []sink.Named) *Indexer {
+	napTime, err := time.ParseDuration(conf.LnxConfig.NapTime)
+	if err != nil {
+		napTime = 20 * time.Minute
+	}
+
+	concurrency := conf.SyncConfig.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	debounce, err := time.ParseDuration(conf.SyncConfig.Debounce)
+	if err != nil {
+		debounce = 10 * time.Second
+	}
+
+	checkpointInterval, err := time.ParseDuration(conf.SyncConfig.CheckpointInterval)
+	if err != nil {
+		checkpointInterval = 0
+	}
+
+	backoffBase, err := time.ParseDuration(conf.SyncConfig.BackoffBase)
+	if err != nil {
+		backoffBase = 30 * time.Second
+	}
+
+	backoffMax, err := time.ParseDuration(conf.SyncConfig.BackoffMax)
+	if err != nil {
+		backoffMax = 30 * time.Minute
+	}
+
+	schemaDrift := conf.SyncConfig.SchemaDrift
+	if schemaDrift == "" {
+		schemaDrift = "refuse"
+	}
+
+	jobs := make([]*job, 0, len(sinks)*len(conf.Boards))
+
+	for _, s := range sinks {
+		for _, board := range conf.Boards {
+			jobs = append(jobs, &job{
+				sink:    s,
+				board:   board,
+				trigger: make(chan struct{}, 1),
+				live:    &sync.Mutex{},
+			})
+		}
+	}
+
+	ix := &Indexer{
+		pg:            pg,
+		jobs:          jobs,
+		boards:        conf.Boards,
+		batchSize:     conf.LnxConfig.BatchSize,
+		napTime:       napTime,
+		semaphore:     make(chan struct{}, concurrency),
+		listenChannel: conf.SyncConfig.ListenChannel,
+		debounce:      debounce,
+
+		checkpointBatches:  conf.SyncConfig.CheckpointBatches,
+		checkpointInterval: checkpointInterval,
+
+		maxFailures: conf.SyncConfig.MaxConsecutiveFailures,
+		backoffBase: backoffBase,
+		backoffMax:  backoffMax,
+
+		schemaDrift: schemaDrift,
+		rebuilds:    make(chan *job),
+
+		active: make(map[*job]bool),
+		paused: make(map[string]bool),
+	}
+
+	ix.pass = ix.indexPass
+
+	return ix
+}
+
+//Setup creates the alias and index tracker rows and the
+//index of every board in every sink, and starts rebuilding
+//the indexes of boards with pending reindex requests or whose
+//schema changed, as allowed by the schema drift policy
+func (ix *Indexer) Setup(ctx context.Context) error {
+	return ix.setup(ctx, true)
+}
+
+//Prepare creates the alias and index tracker rows and the index
+//of every board in every sink like Setup, but leaves pending
+//reindex requests and rebuilds to a running Moon, as commands
+//that exit right away would never sync the new indexes
+func (ix *Indexer) Prepare(ctx context.Context) error {
+	return ix.setup(ctx, false)
+}
+
+func (ix *Indexer) setup(ctx context.Context, rebuild bool) error {
+	if ix.schemaDrift != "refuse" && ix.schemaDrift != "rebuild" {
+		return fmt.Errorf("Unknown schema drift policy %s", ix.schemaDrift)
+	}
+
+	for _, j := range ix.jobs {
+		if err := ix.setupJob(ctx, j, rebuild); err != nil {
+			return fmt.Errorf("Error setting up board %s in %s: %w", j.board.Name, j.sink.Name, err)
+		}
+	}
+
+	ix.mutex.Lock()
+	ix.ready = true
+	ix.mutex.Unlock()
+
+	return nil
+}
+
+//setupJob sets up the board of a job, starting the rebuilds
+//it needs only if rebuild is set
+func (ix *Indexer) setupJob(ctx context.Context, j *job, rebuild bool) error {
+	schema, err := lnx.NewSchema(j.board.Schema)
+
+	if err != nil {
+		return err
+	}
+
+	j.fingerprint = schema.Fingerprint()
+
+	alias := db.IndexAlias{
+		Sink:      j.sink.Name,
+		Board:     j.board.Name,
+		IndexName: fmt.Sprintf("post_%s", j.board.Name),
+	}
+
+	_, err = ix.pg.NewInsert().
+		Model(&alias).
+		On("CONFLICT DO NOTHING").
+		Returning("NULL").
+		Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Error creating index alias: %w", err)
+	}
+
+	if err := ix.pg.NewSelect().Model(&alias).WherePK().Scan(ctx); err != nil {
+		return fmt.Errorf("Error reading index alias: %w", err)
+	}
+
+	indexTracker := db.IndexTracker{
+		Sink:              j.sink.Name,
+		Board:             j.board.Name,
+		IndexName:         alias.IndexName,
+		LastModified:      time.UnixMicro(0),
+		PostNumber:        0,
+		SchemaFingerprint: j.fingerprint,
+	}
+
+	_, err = ix.pg.NewInsert().
+		Model(&indexTracker).
+		On("CONFLICT DO NOTHING").
+		Returning("NULL").
+		Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Error creating index tracker: %w", err)
+	}
+
+	if err := j.sink.CreateIndex(ctx, alias.IndexName, j.board); err != nil {
+		return fmt.Errorf("Error creating index: %w", err)
+	}
+
+	if rebuild {
+		if _, err := ix.takeReindexRequests(ctx, j); err != nil {
+			return fmt.Errorf("Error taking reindex requests: %w", err)
+		}
+	} else {
+		pending, err := ix.pg.NewSelect().
+			Model((*db.ReindexRequest)(nil)).
+			Where("sink = ?", j.sink.Name).
+			Where("board = ?", j.board.Name).
+			Where("done_at IS NULL").
+			Exists(ctx)
+
+		if err != nil {
+			return fmt.Errorf("Error reading reindex requests: %w", err)
+		}
+
+		if pending {
+			j.logger().Info("Leaving the pending reindex to a running Moon")
+			return ix.createShadows(ctx, j)
+		}
+	}
+
+	drifted, err := ix.checkSchema(ctx, j)
+
+	if err != nil {
+		return err
+	}
+
+	if drifted && rebuild {
+		if _, _, err := ix.startRebuild(ctx, ix.pg, j); err != nil {
+			return fmt.Errorf("Error starting rebuild: %w", err)
+		}
+	} else if drifted {
+		j.logger().Info("Leaving the rebuild to a running Moon")
+	}
+
+	return ix.createShadows(ctx, j)
+}
+
+//createShadows creates the indexes of the board being rebuilt
+func (ix *Indexer) createShadows(ctx context.Context, j *job) error {
+	shadows, err := ix.shadows(ctx, j)
+
+	if err != nil {
+		return fmt.Errorf("Error reading rebuilds: %w", err)
+	}
+
+	for _, shadow := range shadows {
+		if err := j.sink.CreateIndex(ctx, shadow, j.board); err != nil {
+			return fmt.Errorf("Error creating index %s: %w", shadow, err)
+		}
+	}
+
+	return nil
+}
+
+//Trigger wakes up a napping board so it gets indexed into
+//every sink right away. Triggering a board that is already
+//being indexed schedules another pass right after it.
+func (ix *Indexer) Trigger(board string) {
+	for _, j := range ix.jobs {
+		if j.board.Name != board {
+			continue
+		}
+
+		select {
+		case j.trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+//Run indexes every board into every sink until ctx is
+//cancelled. Each sink keeps its own cursor for every board,
+//so a sink lagging behind doesn't hold back the rest. Indexes
+//being rebuilt are synced alongside the live ones and switched
+//over to once they catch up. Boards are indexed concurrently,
+//but no more than the configured number at the same time. A
+//board that fails is backed off without affecting the others,
+//and given up on once it fails too many times in a row, while
+//the rest keep being synced.
+func (ix *Indexer) Run(ctx context.Context) error {
+	jobs := ix.jobs
+
+	for _, j := range ix.jobs {
+		shadows, err := ix.shadows(ctx, j)
+
+		if err != nil {
+			return fmt.Errorf("Error reading rebuilds of board %s in %s: %w", j.board.Name, j.sink.Name, err)
+		}
+
+		for _, shadow := range shadows {
+			jobs = append(jobs, j.shadowJob(shadow))
+		}
+	}
+
+	if ix.listenChannel != "" {
+		go ix.listen(ctx)
+	}
+
+	return ix.runJobs(ctx, jobs)
+}
+
+//runJobs runs the jobs passed, along with the rebuilds started
+//meanwhile, until ctx is cancelled and every job has stopped
+func (ix *Indexer) runJobs(ctx context.Context, jobs []*job) error {
+	var wg sync.WaitGroup
+
+	errs := make(chan error, 1)
+
+	start := func(j *job) {
+		wg.Add(1)
+
+		ix.mutex.Lock()
+		ix.active[j] = true
+		ix.mutex.Unlock()
+
+		go func() {
+			defer wg.Done()
+
+			err := ix.runJob(ctx, j)
+
+			//Jobs given up on are kept around so
+			//the admin API can still report them
+			ix.mutex.Lock()
+			if !j.givenUp() {
+				delete(ix.active, j)
+			}
+			ix.mutex.Unlock()
+
+			if err != nil {
+				select {
+				case errs <- err:
+				default:
+				}
+			}
+		}()
+	}
+
+	for _, j := range jobs {
+		start(j)
+	}
+
+	for {
+		select {
+		case j := <-ix.rebuilds:
+			start(j)
+		case <-ctx.Done():
+			wg.Wait()
+			close(errs)
+
+			return <-errs
+		}
+	}
+}
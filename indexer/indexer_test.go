@@ -0,0 +1,200 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"moon/db"
+	"moon/sink"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewIndexerJobs(t *testing.T) {
+	ix := newTestIndexer(map[string]sink.Sink{"lnx": newFakeSink(), "jsonl": newFakeSink()}, "a", "b", "c")
+
+	if len(ix.jobs) != 6 {
+		t.Fatalf("NewIndexer() made %d jobs, want 6", len(ix.jobs))
+	}
+
+	seen := make(map[[2]string]bool)
+
+	for _, j := range ix.jobs {
+		seen[[2]string{j.sink.Name, j.board.Name}] = true
+
+		if j.shadow != "" || j.live == nil || j.trigger == nil {
+			t.Errorf("Job of board %s in %s isn't set up as a live job", j.board.Name, j.sink.Name)
+		}
+	}
+
+	if len(seen) != 6 {
+		t.Errorf("NewIndexer() made jobs for %d board and sink pairs, want 6", len(seen))
+	}
+
+	if !ix.hasBoard("b") || ix.hasBoard("d") {
+		t.Error("hasBoard() doesn't match the boards configured")
+	}
+}
+
+func TestTrigger(t *testing.T) {
+	ix := newTestIndexer(map[string]sink.Sink{"lnx": newFakeSink(), "jsonl": newFakeSink()}, "a", "b")
+
+	ix.Trigger("a")
+	ix.Trigger("a")
+	ix.Trigger("c")
+
+	for _, j := range ix.jobs {
+		want := 0
+
+		if j.board.Name == "a" {
+			want = 1
+		}
+
+		if len(j.trigger) != want {
+			t.Errorf("Job of board %s in %s has %d passes queued, want %d", j.board.Name, j.sink.Name, len(j.trigger), want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	ix := &Indexer{backoffBase: time.Second, backoffMax: 5 * time.Second}
+
+	for failures, want := range []time.Duration{time.Second, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if delay := ix.backoff(failures); delay != want {
+			t.Errorf("backoff(%d) = %s, want %s", failures, delay, want)
+		}
+	}
+}
+
+func TestShouldCheckpoint(t *testing.T) {
+	never := &Indexer{}
+
+	if never.shouldCheckpoint(1000, time.Now().Add(-time.Hour)) {
+		t.Error("Checkpointing without batches or interval configured")
+	}
+
+	ix := &Indexer{checkpointBatches: 10, checkpointInterval: time.Minute}
+
+	if ix.shouldCheckpoint(9, time.Now()) {
+		t.Error("Checkpointing before enough batches or time went by")
+	}
+
+	if !ix.shouldCheckpoint(10, time.Now()) || !ix.shouldCheckpoint(1, time.Now().Add(-time.Minute)) {
+		t.Error("Not checkpointing after enough batches or time went by")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	ctx := context.Background()
+
+	counted := newFakeSink()
+
+	if err := probe(ctx, sink.Named{Sink: counted, Name: "lnx"}, "post_a"); err != nil {
+		t.Errorf("probe() = %s, want nil", err)
+	}
+
+	counted.countErr = sink.ErrUnsupported
+
+	if err := probe(ctx, sink.Named{Sink: counted, Name: "jsonl"}, "post_a"); err != nil {
+		t.Errorf("probe() of a sink that can't count = %s, want nil", err)
+	}
+
+	counted.countErr = errors.New("Index missing")
+
+	if err := probe(ctx, sink.Named{Sink: counted, Name: "lnx"}, "post_a"); err != counted.countErr {
+		t.Errorf("probe() = %v, want %s", err, counted.countErr)
+	}
+
+	prober := &fakeProber{fakeSink: newFakeSink()}
+	prober.countErr = errors.New("Counted instead of probing")
+
+	if err := probe(ctx, sink.Named{Sink: prober, Name: "lnx"}, "post_a"); err != nil || len(prober.probed) != 1 {
+		t.Errorf("probe() = %v after probing %v, want the index probed", err, prober.probed)
+	}
+}
+
+func TestReadyBeforeSetup(t *testing.T) {
+	ix := newTestIndexer(map[string]sink.Sink{"lnx": newFakeSink()}, "a")
+
+	if err := ix.Ready(context.Background()); err == nil {
+		t.Error("Ready() before Setup succeeded")
+	}
+
+	if err := ix.Healthy(time.Minute); err != nil {
+		t.Errorf("Healthy() with no pass in progress = %s, want nil", err)
+	}
+}
+
+func TestRunJobsGivesUpAlone(t *testing.T) {
+	broken := newFakeSink()
+	broken.upsertErr = func(posts []db.Post) error {
+		return errors.New("Connection refused")
+	}
+
+	working := newFakeSink()
+
+	ix := newTestIndexer(map[string]sink.Sink{"broken": broken, "lnx": working}, "a")
+	ix.maxFailures = 3
+	ix.backoffBase = time.Millisecond
+	ix.backoffMax = time.Millisecond
+	ix.napTime = time.Millisecond
+
+	//Every pass upserts a post further along the board
+	var postNumber atomic.Int64
+
+	ix.pass = func(ctx context.Context, j *job) error {
+		return j.sink.Upsert(ctx, []db.Post{{Board: "a", PostNumber: postNumber.Add(1)}}, "post_a", time.Time{})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- ix.runJobs(ctx, ix.jobs)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		count, _ := working.Count(ctx, "post_a")
+
+		if count >= int64(ix.maxFailures)*5 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Working sink only got %d posts", count)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Errorf("runJobs() = %s, want nil", err)
+	}
+
+	broken.mutex.Lock()
+	attempts := len(broken.upserts)
+	broken.mutex.Unlock()
+
+	if attempts != ix.maxFailures {
+		t.Errorf("Broken sink was tried %d times, want %d", attempts, ix.maxFailures)
+	}
+
+	statuses := ix.Jobs()
+
+	if len(statuses) != 1 || statuses[0].Sink != "broken" || !statuses[0].GaveUp || statuses[0].Failures != ix.maxFailures {
+		t.Errorf("Jobs() = %+v, want only the broken sink given up on", statuses)
+	}
+
+	ix.ready = true
+
+	if err := ix.Ready(ctx); err == nil || !strings.Contains(err.Error(), "Gave up on board a in broken") {
+		t.Errorf("Ready() = %v, want the broken sink reported", err)
+	}
+}
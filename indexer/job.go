@@ -0,0 +1,271 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"moon/config"
+	"moon/sink"
+	"sync"
+	"time"
+)
+
+//job syncs a single board into a single sink
+type job struct {
+	sink    sink.Named
+	board   config.BoardConfig
+	trigger chan struct{}
+
+	//shadow is the index a rebuild is being synced into,
+	//or empty for jobs syncing the index the board is
+	//served from
+	shadow string
+
+	//fingerprint identifies the current schema of the board
+	fingerprint string
+
+	//live is shared by every job of the same board and
+	//sink and held during live passes and cutovers, so
+	//the alias can't switch over halfway through a pass
+	live *sync.Mutex
+
+	//state is what the admin API and health checks
+	//report about the job. progress is when the pass in
+	//progress last moved forward, zero between passes.
+	state      sync.Mutex
+	failures   int
+	lastError  error
+	lastFailed time.Time
+	progress   time.Time
+
+	//gaveUp is set once the job failed too many
+	//times in a row and was stopped for good
+	gaveUp bool
+}
+
+//logger returns a logger carrying the board, sink and
+//index being rebuilt, if any, of the job
+func (j *job) logger() *slog.Logger {
+	logger := slog.With("board", j.board.Name, "sink", j.sink.Name)
+
+	if j.shadow != "" {
+		logger = logger.With("rebuild", j.shadow)
+	}
+
+	return logger
+}
+
+//name describes the job in errors
+func (j *job) name() string {
+	if j.shadow == "" {
+		return j.sink.Name
+	}
+
+	return fmt.Sprintf("%s (rebuilding into %s)", j.sink.Name, j.shadow)
+}
+
+func (ix *Indexer) runJob(ctx context.Context, j *job) error {
+	failures := 0
+
+	for {
+		if ix.Paused(j.board.Name) {
+			ix.nap(ctx, j)
+
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			continue
+		}
+
+		select {
+		case ix.semaphore <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+
+		err := ix.pass(ctx, j)
+		<-ix.semaphore
+
+		if err == nil && j.shadow != "" && ctx.Err() == nil {
+			if err = ix.cutover(ctx, j); err == nil {
+				return nil
+			}
+		}
+
+		if err != nil && ctx.Err() != nil {
+			return fmt.Errorf("Error stopping board %s in %s: %w", j.board.Name, j.name(), err)
+		}
+
+		if ctx.Err() != nil {
+			j.logger().Info("Stopped board")
+			return nil
+		}
+
+		j.record(failures, err)
+
+		if err != nil {
+			failures++
+
+			j.logger().Error("Error indexing board", "failures", failures, "error", err)
+
+			if ix.maxFailures > 0 && failures >= ix.maxFailures {
+				j.logger().Error("Giving up on board", "failures", failures)
+				j.giveUp()
+
+				return nil
+			}
+
+			delay := ix.backoff(failures)
+			j.logger().Info("Backing off board", "delay", delay)
+
+			timer := time.NewTimer(delay)
+
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
+
+			continue
+		}
+
+		failures = 0
+
+		j.logger().Debug("Napping board")
+		ix.nap(ctx, j)
+	}
+}
+
+//indexPass starts the rebuilds requested for the board of a
+//live job, then syncs the index of the job
+func (ix *Indexer) indexPass(ctx context.Context, j *job) error {
+	if j.shadow == "" {
+		ix.rebuildIfRequested(ctx, j)
+	}
+
+	return ix.indexBoard(ctx, j)
+}
+
+//record keeps the outcome of the last pass of the job
+//for the admin API, along with the failures before it
+func (j *job) record(failures int, err error) {
+	j.state.Lock()
+	defer j.state.Unlock()
+
+	if err == nil {
+		j.failures = 0
+		return
+	}
+
+	j.failures = failures + 1
+	j.lastError = err
+	j.lastFailed = time.Now()
+}
+
+//giveUp records the job was stopped after failing too many
+//times in a row
+func (j *job) giveUp() {
+	j.state.Lock()
+	j.gaveUp = true
+	j.state.Unlock()
+}
+
+//givenUp reports whether the job was stopped for good
+func (j *job) givenUp() bool {
+	j.state.Lock()
+	defer j.state.Unlock()
+
+	return j.gaveUp
+}
+
+//advance records the pass in progress moved forward
+func (j *job) advance() {
+	j.state.Lock()
+	j.progress = time.Now()
+	j.state.Unlock()
+}
+
+//finish records the pass in progress is over
+func (j *job) finish() {
+	j.state.Lock()
+	j.progress = time.Time{}
+	j.state.Unlock()
+}
+
+//rebuildIfRequested starts a rebuild of the board if it has
+//been requested since the last pass, running it alongside
+func (ix *Indexer) rebuildIfRequested(ctx context.Context, j *job) {
+	shadow, err := ix.takeReindexRequests(ctx, j)
+
+	if err != nil {
+		j.logger().Error("Error reading reindex requests", "error", err)
+		return
+	}
+
+	if shadow == "" {
+		return
+	}
+
+	select {
+	case ix.rebuilds <- j.shadowJob(shadow):
+	case <-ctx.Done():
+	}
+}
+
+//shadowJob returns a job syncing the board into an index
+//being rebuilt, sharing the lock of the live one
+func (j *job) shadowJob(shadow string) *job {
+	return &job{
+		sink:        j.sink,
+		board:       j.board,
+		trigger:     make(chan struct{}, 1),
+		shadow:      shadow,
+		fingerprint: j.fingerprint,
+		live:        j.live,
+	}
+}
+
+//backoff returns how long a board should wait before being
+//retried, doubling with every consecutive failure up to backoffMax
+func (ix *Indexer) backoff(failures int) time.Duration {
+	delay := ix.backoffBase
+
+	for i := 1; i < failures && delay < ix.backoffMax; i++ {
+		delay *= 2
+	}
+
+	if delay > ix.backoffMax {
+		delay = ix.backoffMax
+	}
+
+	return delay
+}
+
+//nap sleeps for napTime or until the board is triggered,
+//in which case it waits for the debounce period so bursts
+//of notifications result in a single pass
+func (ix *Indexer) nap(ctx context.Context, j *job) {
+	timer := time.NewTimer(ix.napTime)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	case <-j.trigger:
+		j.logger().Debug("Board triggered")
+
+		debounce := time.NewTimer(ix.debounce)
+		defer debounce.Stop()
+
+		select {
+		case <-debounce.C:
+		case <-ctx.Done():
+		}
+
+		select {
+		case <-j.trigger:
+		default:
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package indexer
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+//listen triggers boards as notifications come in on the
+//configured Postgres channel. The payload is expected to be
+//the board name, while an empty payload triggers every board.
+func (ix *Indexer) listen(ctx context.Context) {
+	ln := pgdriver.NewListener(ix.pg)
+
+	if err := ln.Listen(ctx, ix.listenChannel); err != nil {
+		slog.Error("Error listening, falling back to napping", "channel", ix.listenChannel, "error", err)
+		return
+	}
+
+	slog.Info("Listening for notifications", "channel", ix.listenChannel)
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for notification := range ln.Channel() {
+		if notification.Payload == "" {
+			for _, board := range ix.boards {
+				ix.Trigger(board.Name)
+			}
+
+			continue
+		}
+
+		ix.Trigger(notification.Payload)
+	}
+}
+
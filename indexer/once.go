@@ -0,0 +1,55 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+//SyncOnce makes a single pass over the board into every sink,
+//or over every board if board is empty, honouring the configured
+//concurrency. Boards that fail don't stop the rest, but make
+//SyncOnce return an error once every pass is done.
+func (ix *Indexer) SyncOnce(ctx context.Context, board string) error {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+
+	failed := 0
+
+	for _, j := range ix.jobs {
+		if board != "" && j.board.Name != board {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(j *job) {
+			defer wg.Done()
+
+			select {
+			case ix.semaphore <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			err := ix.indexBoard(ctx, j)
+			<-ix.semaphore
+
+			if err != nil {
+				j.logger().Error("Error indexing board", "error", err)
+
+				mutex.Lock()
+				failed++
+				mutex.Unlock()
+			}
+		}(j)
+	}
+
+	wg.Wait()
+
+	if failed > 0 {
+		return fmt.Errorf("%d passes failed", failed)
+	}
+
+	return ctx.Err()
+}
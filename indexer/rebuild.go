@@ -0,0 +1,264 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"moon/db"
+	"moon/metrics"
+	"moon/sink"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+//startRebuild creates a tracker for a new index of the board
+//unless a rebuild with the current schema is already underway,
+//returning the name of the new index, or of the one underway
+//along with started unset. The new index is synced from
+//scratch while searches keep being served from the old one.
+func (ix *Indexer) startRebuild(ctx context.Context, idb bun.IDB, j *job) (index string, started bool, err error) {
+	var underway []string
+
+	err = idb.NewSelect().
+		Model((*db.IndexTracker)(nil)).
+		Column("index_name").
+		Where("sink = ?", j.sink.Name).
+		Where("board = ?", j.board.Name).
+		Where("schema_fingerprint = ?", j.fingerprint).
+		Where("index_name <> (?)", idb.NewSelect().
+			Model((*db.IndexAlias)(nil)).
+			Column("index_name").
+			Where("sink = ?", j.sink.Name).
+			Where("board = ?", j.board.Name)).
+		Scan(ctx, &underway)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	if len(underway) > 0 {
+		j.logger().Info("Rebuild already underway", "index", underway[0])
+		return underway[0], false, nil
+	}
+
+	indexTracker := db.IndexTracker{
+		Sink:              j.sink.Name,
+		Board:             j.board.Name,
+		IndexName:         fmt.Sprintf("post_%s_%d", j.board.Name, time.Now().Unix()),
+		LastModified:      time.UnixMicro(0),
+		PostNumber:        0,
+		SchemaFingerprint: j.fingerprint,
+	}
+
+	_, err = idb.NewInsert().
+		Model(&indexTracker).
+		Returning("NULL").
+		Exec(ctx)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	j.logger().Info("Rebuilding board", "index", indexTracker.IndexName)
+
+	return indexTracker.IndexName, true, nil
+}
+
+//takeReindexRequests starts a rebuild if the board has pending
+//reindex requests, creating the new index, and marks them as
+//done by it. A rebuild already underway with the current schema
+//is recorded as doing them instead, and no index is returned.
+//Everything happens in the same transaction, so requests aren't
+//lost if starting the rebuild fails.
+func (ix *Indexer) takeReindexRequests(ctx context.Context, j *job) (string, error) {
+	tx, err := ix.pg.BeginTx(ctx, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback()
+
+	var requests []int64
+
+	err = tx.NewSelect().
+		Model((*db.ReindexRequest)(nil)).
+		Column("id").
+		Where("sink = ?", j.sink.Name).
+		Where("board = ?", j.board.Name).
+		Where("done_at IS NULL").
+		For("UPDATE").
+		Scan(ctx, &requests)
+
+	if err != nil || len(requests) == 0 {
+		return "", err
+	}
+
+	j.logger().Info("Reindex requested", "requests", len(requests))
+
+	index, started, err := ix.startRebuild(ctx, tx, j)
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*db.ReindexRequest)(nil)).
+		Set("done_at = now()").
+		Set("index_name = ?", index).
+		Where("id IN (?)", bun.In(requests)).
+		Exec(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !started {
+		return "", tx.Commit()
+	}
+
+	if err := j.sink.CreateIndex(ctx, index, j.board); err != nil {
+		return "", err
+	}
+
+	return index, tx.Commit()
+}
+
+//shadows returns the indexes of the board being rebuilt,
+//which are the ones with a tracker but no alias pointing to them
+func (ix *Indexer) shadows(ctx context.Context, j *job) ([]string, error) {
+	var shadows []string
+
+	err := ix.pg.NewSelect().
+		Model((*db.IndexTracker)(nil)).
+		Column("index_name").
+		Where("sink = ?", j.sink.Name).
+		Where("board = ?", j.board.Name).
+		Where("index_name <> (?)", ix.pg.NewSelect().
+			Model((*db.IndexAlias)(nil)).
+			Column("index_name").
+			Where("sink = ?", j.sink.Name).
+			Where("board = ?", j.board.Name)).
+		Order("index_name ASC").
+		Scan(ctx, &shadows)
+
+	return shadows, err
+}
+
+//cutover points the alias of the board to the index a rebuild
+//has synced, as long as it holds at least as many posts as the
+//database up to its cursor, less those it set aside as dead
+//letters, and then drops the old index along with its dead letters.
+//Live passes are held off for the duration, so the switch
+//happens between two of them.
+func (ix *Indexer) cutover(ctx context.Context, j *job) error {
+	j.live.Lock()
+	defer j.live.Unlock()
+
+	indexTracker := db.IndexTracker{
+		Sink:      j.sink.Name,
+		Board:     j.board.Name,
+		IndexName: j.shadow,
+	}
+
+	if err := ix.pg.NewSelect().Model(&indexTracker).WherePK().Scan(ctx); err != nil {
+		return ix.stopped(ctx, err)
+	}
+
+	expected, err := ix.pg.NewSelect().
+		Model((*db.Post)(nil)).
+		Where("board = ?", j.board.Name).
+		Where("hidden = false").
+		Where("(last_modified, post_number) <= (?, ?)", indexTracker.LastModified, indexTracker.PostNumber).
+		Count(ctx)
+
+	if err != nil {
+		return ix.stopped(ctx, err)
+	}
+
+	deadLetters, err := ix.pg.NewSelect().
+		Model((*db.DeadLetter)(nil)).
+		Join("JOIN post ON post.board = dead_letter.board AND post.post_number = dead_letter.post_number").
+		Where("dead_letter.sink = ?", j.sink.Name).
+		Where("dead_letter.board = ?", j.board.Name).
+		Where("dead_letter.index_name = ?", j.shadow).
+		Where("post.hidden = false").
+		Where("(post.last_modified, post.post_number) <= (?, ?)", indexTracker.LastModified, indexTracker.PostNumber).
+		Count(ctx)
+
+	if err != nil {
+		return ix.stopped(ctx, err)
+	}
+
+	expected -= deadLetters
+
+	count, err := j.sink.Count(ctx, j.shadow)
+
+	if errors.Is(err, sink.ErrUnsupported) {
+		j.logger().Info("Skipping verification, as the sink can't count posts")
+	} else if err != nil {
+		return ix.stopped(ctx, err)
+	} else if count < int64(expected) {
+		return fmt.Errorf("Index %s holds %d posts while the database holds %d", j.shadow, count, expected)
+	}
+
+	tx, err := ix.pg.BeginTx(ctx, nil)
+
+	if err != nil {
+		return ix.stopped(ctx, err)
+	}
+
+	alias := db.IndexAlias{Sink: j.sink.Name, Board: j.board.Name}
+
+	if err := tx.NewSelect().Model(&alias).WherePK().For("UPDATE").Scan(ctx); err != nil {
+		tx.Rollback()
+		return ix.stopped(ctx, err)
+	}
+
+	old := alias.IndexName
+	alias.IndexName = j.shadow
+
+	if _, err := tx.NewUpdate().Model(&alias).WherePK().Returning("NULL").Exec(ctx); err != nil {
+		tx.Rollback()
+		return ix.stopped(ctx, err)
+	}
+
+	_, err = tx.NewDelete().
+		Model((*db.IndexTracker)(nil)).
+		Where("sink = ?", j.sink.Name).
+		Where("board = ?", j.board.Name).
+		Where("index_name = ?", old).
+		Exec(ctx)
+
+	if err != nil {
+		tx.Rollback()
+		return ix.stopped(ctx, err)
+	}
+
+	_, err = tx.NewDelete().
+		Model((*db.DeadLetter)(nil)).
+		Where("sink = ?", j.sink.Name).
+		Where("board = ?", j.board.Name).
+		Where("index_name = ?", old).
+		Exec(ctx)
+
+	if err != nil {
+		tx.Rollback()
+		return ix.stopped(ctx, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ix.stopped(ctx, err)
+	}
+
+	j.logger().Info("Switched board over", "from", old, "to", j.shadow)
+
+	metrics.ForgetTracker(j.sink.Name, j.board.Name, old)
+
+	if err := j.sink.DropIndex(ctx, old); err != nil {
+		j.logger().Error("Error dropping index", "index", old, "error", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package indexer
+
+import (
+	"context"
+	"moon/db"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+//Reset moves the cursor of the live index of a board in
+//every sink passed back, or forward, to the time passed,
+//returning how many cursors were moved. Posts modified
+//since are reindexed on the next pass.
+func Reset(ctx context.Context, pg bun.IDB, board string, sinks []string, to time.Time) (int64, error) {
+	result, err := pg.NewUpdate().
+		Model((*db.IndexTracker)(nil)).
+		Set("last_modified = ?", to).
+		Set("post_number = 0").
+		Where("board = ?", board).
+		Where("sink IN (?)", bun.In(sinks)).
+		Where("index_name = (?)", pg.NewSelect().
+			Model((*db.IndexAlias)(nil)).
+			Column("index_name").
+			Where("index_alias.sink = index_tracker.sink").
+			Where("index_alias.board = index_tracker.board")).
+		Exec(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
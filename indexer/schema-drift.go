@@ -0,0 +1,96 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"moon/db"
+	"moon/sink"
+)
+
+//checkSchema compares the schema every index of the board was
+//created with against the current one. Rebuilds started with an
+//outdated schema are discarded, and whether the live index needs
+//a rebuild is reported, or an error returned if the schema drift
+//policy refuses it. Indexes created before fingerprints were kept
+//are assumed to match, and sinks ignoring the schema are never
+//checked. Pending reindex requests must be taken beforehand, so
+//the rebuilds they start count.
+func (ix *Indexer) checkSchema(ctx context.Context, j *job) (bool, error) {
+	if schemaless, ok := j.sink.Sink.(sink.Schemaless); ok && schemaless.Schemaless() {
+		return false, nil
+	}
+
+	alias := db.IndexAlias{Sink: j.sink.Name, Board: j.board.Name}
+
+	if err := ix.pg.NewSelect().Model(&alias).WherePK().Scan(ctx); err != nil {
+		return false, fmt.Errorf("Error reading index alias: %w", err)
+	}
+
+	var indexTrackers []db.IndexTracker
+
+	err := ix.pg.NewSelect().
+		Model(&indexTrackers).
+		Where("sink = ?", j.sink.Name).
+		Where("board = ?", j.board.Name).
+		Scan(ctx)
+
+	if err != nil {
+		return false, fmt.Errorf("Error reading index trackers: %w", err)
+	}
+
+	liveDrifted := false
+	rebuilding := false
+
+	for i := range indexTrackers {
+		indexTracker := &indexTrackers[i]
+
+		if indexTracker.SchemaFingerprint == "" {
+			j.logger().Info("Recording schema fingerprint", "index", indexTracker.IndexName)
+
+			indexTracker.SchemaFingerprint = j.fingerprint
+
+			_, err := ix.pg.NewUpdate().
+				Model(indexTracker).
+				Column("schema_fingerprint").
+				WherePK().
+				Returning("NULL").
+				Exec(ctx)
+
+			if err != nil {
+				return false, fmt.Errorf("Error recording schema fingerprint: %w", err)
+			}
+		}
+
+		if indexTracker.IndexName == alias.IndexName {
+			liveDrifted = indexTracker.SchemaFingerprint != j.fingerprint
+			continue
+		}
+
+		if indexTracker.SchemaFingerprint == j.fingerprint {
+			rebuilding = true
+			continue
+		}
+
+		j.logger().Warn("Discarding rebuild, as the schema changed since", "index", indexTracker.IndexName)
+
+		if err := j.sink.DropIndex(ctx, indexTracker.IndexName); err != nil {
+			return false, fmt.Errorf("Error dropping index %s: %w", indexTracker.IndexName, err)
+		}
+
+		if _, err := ix.pg.NewDelete().Model(indexTracker).WherePK().Exec(ctx); err != nil {
+			return false, fmt.Errorf("Error deleting index tracker of %s: %w", indexTracker.IndexName, err)
+		}
+	}
+
+	if !liveDrifted || rebuilding {
+		return false, nil
+	}
+
+	if ix.schemaDrift == "refuse" {
+		return false, fmt.Errorf("Schema changed since index %s was created. Set schema_drift to \"rebuild\" or run moon reindex %s to rebuild it", alias.IndexName, j.board.Name)
+	}
+
+	j.logger().Warn("Schema changed since the index was created", "index", alias.IndexName)
+
+	return true, nil
+}
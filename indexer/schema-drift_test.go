@@ -0,0 +1,20 @@
+package indexer
+
+import (
+	"context"
+	"moon/sink"
+	"testing"
+)
+
+//The indexer is built without a database, so any
+//query made for a schemaless sink would panic
+func TestCheckSchemaSkipsSchemaless(t *testing.T) {
+	ix := newTestIndexer(map[string]sink.Sink{"jsonl": &fakeSchemaless{fakeSink: newFakeSink()}}, "a")
+	ix.jobs[0].fingerprint = "changed"
+
+	drifted, err := ix.checkSchema(context.Background(), ix.jobs[0])
+
+	if drifted || err != nil {
+		t.Errorf("checkSchema() = %t, %v, want false, nil", drifted, err)
+	}
+}
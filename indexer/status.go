@@ -0,0 +1,100 @@
+package indexer
+
+import (
+	"context"
+	"moon/db"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+//TrackerStatus is how far an index of a board
+//in a sink is from being synced up
+type TrackerStatus struct {
+	Sink         string        `json:"sink"`
+	Board        string        `json:"board"`
+	IndexName    string        `json:"index_name"`
+	Live         bool          `json:"live"`
+	LastModified time.Time     `json:"last_modified"`
+	PostNumber   int64         `json:"post_number"`
+	Pending      int           `json:"pending"`
+	Lag          time.Duration `json:"lag"`
+}
+
+//Status returns the status of every index tracker. Pending
+//is the number of posts past the cursor, while lag is how far
+//behind the last modified post the cursor is.
+func Status(ctx context.Context, pg bun.IDB) ([]TrackerStatus, error) {
+	var indexTrackers []db.IndexTracker
+
+	err := pg.NewSelect().
+		Model(&indexTrackers).
+		Order("board ASC", "sink ASC", "index_name ASC").
+		Scan(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var aliases []db.IndexAlias
+
+	if err := pg.NewSelect().Model(&aliases).Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	live := make(map[db.IndexAlias]bool, len(aliases))
+
+	for _, alias := range aliases {
+		live[alias] = true
+	}
+
+	statuses := make([]TrackerStatus, 0, len(indexTrackers))
+
+	for _, indexTracker := range indexTrackers {
+		status := TrackerStatus{
+			Sink:         indexTracker.Sink,
+			Board:        indexTracker.Board,
+			IndexName:    indexTracker.IndexName,
+			LastModified: indexTracker.LastModified,
+			PostNumber:   indexTracker.PostNumber,
+			Live: live[db.IndexAlias{
+				Sink:      indexTracker.Sink,
+				Board:     indexTracker.Board,
+				IndexName: indexTracker.IndexName,
+			}],
+		}
+
+		var lastModified []time.Time
+
+		err := pg.NewSelect().
+			Model((*db.Post)(nil)).
+			ColumnExpr("last_modified").
+			Where("board = ?", indexTracker.Board).
+			Where("(last_modified, post_number) > (?, ?)", indexTracker.LastModified, indexTracker.PostNumber).
+			Order("last_modified DESC").
+			Limit(1).
+			Scan(ctx, &lastModified)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(lastModified) > 0 {
+			status.Lag = lastModified[0].Sub(indexTracker.LastModified)
+
+			status.Pending, err = pg.NewSelect().
+				Model((*db.Post)(nil)).
+				Where("board = ?", indexTracker.Board).
+				Where("(last_modified, post_number) > (?, ?)", indexTracker.LastModified, indexTracker.PostNumber).
+				Count(ctx)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
@@ -0,0 +1,316 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"moon/db"
+	"moon/sink"
+	"sort"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+//Discrepancy is a range of post numbers in which the live
+//index of a board holds different posts than the database
+type Discrepancy struct {
+	Sink       string  `json:"sink"`
+	Board      string  `json:"board"`
+	Index      string  `json:"index"`
+	From       int64   `json:"from"`
+	To         int64   `json:"to"`
+	Expected   int64   `json:"expected"`
+	Found      int64   `json:"found"`
+	Missing    []int64 `json:"missing"`
+	Extra      []int64 `json:"extra"`
+	Duplicated []int64 `json:"duplicated"`
+	Repaired   bool    `json:"repaired"`
+}
+
+//Verify walks the live index of a board in every sink that
+//can look up posts, rangeSize post numbers at a time, and
+//compares it with the visible posts in the database. Ranges
+//whose counts match are skipped, while the post numbers of
+//the rest are compared one by one. Posts modified past the
+//cursor and dead letters are left out, as they aren't
+//expected to be in the index yet. If repair is set, missing
+//and duplicated posts are upserted again and extra ones are
+//deleted.
+func (ix *Indexer) Verify(ctx context.Context, board string, rangeSize int64, repair bool) ([]Discrepancy, error) {
+	if !ix.hasBoard(board) {
+		return nil, ErrUnknownBoard
+	}
+
+	discrepancies := make([]Discrepancy, 0)
+
+	for _, j := range ix.jobs {
+		if j.board.Name != board {
+			continue
+		}
+
+		verifier, ok := j.sink.Sink.(sink.Verifier)
+
+		if !ok {
+			j.logger().Info("Skipping verification, as the sink can't look up posts")
+			continue
+		}
+
+		found, err := ix.verifyJob(ctx, j, verifier, rangeSize, repair)
+
+		if err != nil {
+			return discrepancies, fmt.Errorf("Error verifying board %s in %s: %w", j.board.Name, j.sink.Name, err)
+		}
+
+		discrepancies = append(discrepancies, found...)
+	}
+
+	return discrepancies, nil
+}
+
+//verifyJob verifies the live index of the board of a job
+func (ix *Indexer) verifyJob(ctx context.Context, j *job, verifier sink.Verifier, rangeSize int64, repair bool) ([]Discrepancy, error) {
+	j.live.Lock()
+	defer j.live.Unlock()
+
+	alias := db.IndexAlias{Sink: j.sink.Name, Board: j.board.Name}
+
+	if err := ix.pg.NewSelect().Model(&alias).WherePK().Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	indexTracker := db.IndexTracker{Sink: j.sink.Name, Board: j.board.Name, IndexName: alias.IndexName}
+
+	if err := ix.pg.NewSelect().Model(&indexTracker).WherePK().Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	var first, last int64
+
+	err := ix.pg.NewSelect().
+		Model((*db.Post)(nil)).
+		ColumnExpr("COALESCE(MIN(post_number), 0)").
+		ColumnExpr("COALESCE(MAX(post_number), 0)").
+		Where("board = ?", j.board.Name).
+		Scan(ctx, &first, &last)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var deadLetters []int64
+
+	err = ix.pg.NewSelect().
+		Model((*db.DeadLetter)(nil)).
+		Column("post_number").
+		Where("sink = ?", j.sink.Name).
+		Where("board = ?", j.board.Name).
+		Where("index_name = ?", alias.IndexName).
+		Scan(ctx, &deadLetters)
+
+	if err != nil {
+		return nil, err
+	}
+
+	skipped := make(map[int64]bool, len(deadLetters))
+
+	for _, postNumber := range deadLetters {
+		skipped[postNumber] = true
+	}
+
+	logger := j.logger().With("index", alias.IndexName)
+	logger.Info("Verifying board", "from", first, "to", last, "range_size", rangeSize)
+
+	discrepancies := make([]Discrepancy, 0)
+
+	for from := first; from <= last; from += rangeSize {
+		if ctx.Err() != nil {
+			return discrepancies, ctx.Err()
+		}
+
+		to := from + rangeSize - 1
+
+		d, err := ix.verifyRange(ctx, j, verifier, &indexTracker, skipped, from, to)
+
+		if err != nil {
+			return discrepancies, err
+		}
+
+		if d == nil {
+			continue
+		}
+
+		logger.Warn("Index differs from the database",
+			"from", d.From,
+			"to", d.To,
+			"expected", d.Expected,
+			"found", d.Found,
+			"missing", d.Missing,
+			"extra", d.Extra,
+			"duplicated", d.Duplicated,
+		)
+
+		if repair {
+			if err := ix.repair(ctx, j, alias.IndexName, d); err != nil {
+				return discrepancies, fmt.Errorf("Error repairing posts %d to %d: %w", d.From, d.To, err)
+			}
+
+			d.Repaired = ctx.Err() == nil
+		}
+
+		discrepancies = append(discrepancies, *d)
+	}
+
+	logger.Info("Verified board", "discrepancies", len(discrepancies))
+
+	return discrepancies, nil
+}
+
+//verifyRange compares the posts numbered from from to to, both
+//included, in the index of the tracker and in the database,
+//returning nil if they match
+func (ix *Indexer) verifyRange(ctx context.Context, j *job, verifier sink.Verifier, indexTracker *db.IndexTracker, skipped map[int64]bool, from int64, to int64) (*Discrepancy, error) {
+	var dbPosts []db.Post
+
+	err := ix.pg.NewSelect().
+		Model(&dbPosts).
+		Column("post_number", "hidden", "last_modified").
+		Where("board = ?", j.board.Name).
+		Where("post_number BETWEEN ? AND ?", from, to).
+		Scan(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	expected := make(map[int64]bool, len(dbPosts))
+	ignored := make(map[int64]bool)
+
+	for _, p := range dbPosts {
+		pending := p.LastModified.After(indexTracker.LastModified) ||
+			(p.LastModified.Equal(indexTracker.LastModified) && p.PostNumber > indexTracker.PostNumber)
+
+		if pending || skipped[p.PostNumber] {
+			ignored[p.PostNumber] = true
+		} else if !p.Hidden {
+			expected[p.PostNumber] = true
+		}
+	}
+
+	found, err := verifier.CountRange(ctx, indexTracker.IndexName, from, to)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if found == int64(len(expected)) && len(ignored) == 0 {
+		return nil, nil
+	}
+
+	postNumbers, err := verifier.PostNumbers(ctx, indexTracker.IndexName, from, to)
+
+	if err != nil {
+		return nil, err
+	}
+
+	copies := make(map[int64]int, len(postNumbers))
+
+	for _, postNumber := range postNumbers {
+		copies[postNumber]++
+	}
+
+	d := Discrepancy{
+		Sink:     j.sink.Name,
+		Board:    j.board.Name,
+		Index:    indexTracker.IndexName,
+		From:     from,
+		To:       to,
+		Expected: int64(len(expected)),
+		Found:    found,
+	}
+
+	for postNumber := range expected {
+		if copies[postNumber] == 0 {
+			d.Missing = append(d.Missing, postNumber)
+		}
+	}
+
+	for postNumber, n := range copies {
+		switch {
+		case ignored[postNumber]:
+		case !expected[postNumber]:
+			d.Extra = append(d.Extra, postNumber)
+		case n > 1:
+			d.Duplicated = append(d.Duplicated, postNumber)
+		}
+	}
+
+	if len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Duplicated) == 0 {
+		return nil, nil
+	}
+
+	sortPostNumbers(d.Missing)
+	sortPostNumbers(d.Extra)
+	sortPostNumbers(d.Duplicated)
+
+	return &d, nil
+}
+
+//repair deletes the extra and duplicated posts of a discrepancy
+//from the index and upserts the missing and duplicated ones
+//again. Posts rejected in the process are set aside.
+func (ix *Indexer) repair(ctx context.Context, j *job, index string, d *Discrepancy) error {
+	deletables := make([]db.Post, 0, len(d.Extra)+len(d.Duplicated))
+
+	for _, postNumber := range append(append([]int64{}, d.Extra...), d.Duplicated...) {
+		deletables = append(deletables, db.Post{Board: j.board.Name, PostNumber: postNumber})
+	}
+
+	upsertables := append(append([]int64{}, d.Missing...), d.Duplicated...)
+
+	//The transaction outlives ctx, so it can't be rolled back
+	//behind the back of a sink that already committed
+	tx, err := ix.pg.BeginTx(context.WithoutCancel(ctx), nil)
+
+	if err != nil {
+		return err
+	}
+
+	if err := j.sink.Delete(ctx, deletables, index); err != nil {
+		return ix.abort(ctx, tx, j, index, err)
+	}
+
+	if len(upsertables) > 0 {
+		var posts []db.Post
+
+		err := tx.NewSelect().
+			Model(&posts).
+			Where("board = ?", j.board.Name).
+			Where("post_number IN (?)", bun.In(upsertables)).
+			Where("hidden = false").
+			Order("post_number ASC").
+			For("SHARE").
+			Scan(ctx)
+
+		if err != nil {
+			return ix.abort(ctx, tx, j, index, err)
+		}
+
+		if len(posts) > 0 {
+			if err := ix.upsert(ctx, j, index, posts, time.UnixMicro(0), ix.deadLetters(ctx, tx, j, index)); err != nil {
+				return ix.abort(ctx, tx, j, index, err)
+			}
+		}
+	}
+
+	if err := j.sink.Commit(ctx, index); err != nil {
+		return ix.abort(ctx, tx, j, index, err)
+	}
+
+	return tx.Commit()
+}
+
+func sortPostNumbers(postNumbers []int64) {
+	sort.Slice(postNumbers, func(a, b int) bool {
+		return postNumbers[a] < postNumbers[b]
+	})
+}
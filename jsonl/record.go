@@ -0,0 +1,18 @@
+//Package jsonl exports posts into rotating NDJSON
+//files for offline pipelines to consume
+package jsonl
+
+import (
+	"moon/lnx"
+	"time"
+)
+
+//Record is a line in an exported file, describing
+//a post being either upserted or deleted
+type Record struct {
+	Action       string    `json:"action"`
+	Board        string    `json:"board"`
+	PostNumber   int64     `json:"post_number"`
+	LastModified time.Time `json:"last_modified"`
+	Post         *lnx.Post `json:"post,omitempty"`
+}
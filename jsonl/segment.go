@@ -0,0 +1,167 @@
+package jsonl
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//cursor is a position in the (last_modified, post_number)
+//order Moon walks the posts of a board in
+type cursor struct {
+	lastModified time.Time
+	postNumber   int64
+}
+
+//before reports whether c comes before other
+func (c cursor) before(other cursor) bool {
+	return c.lastModified.Before(other.lastModified) ||
+		(c.lastModified.Equal(other.lastModified) && c.postNumber < other.postNumber)
+}
+
+func (c cursor) String() string {
+	return fmt.Sprintf("%s_%d", c.lastModified.UTC().Format("20060102T150405.000000Z"), c.postNumber)
+}
+
+//segment is a file being written to. It's kept under a
+//temporary name until committed, when it's renamed after
+//the range of cursors it covers. Records aren't always
+//written in cursor order, as retried dead letters come
+//first, so the range is the lowest and highest cursor seen.
+//size is the number of bytes written to the file, after
+//compression if any.
+type segment struct {
+	file    *os.File
+	buffer  *bufio.Writer
+	gzip    *gzip.Writer
+	encoder *json.Encoder
+	size    int64
+	records int
+	from    cursor
+	to      cursor
+}
+
+func newSegment(dir string, compress bool) (*segment, error) {
+	file, err := os.CreateTemp(dir, "*.pending")
+
+	if err != nil {
+		return nil, err
+	}
+
+	seg := segment{
+		file:   file,
+		buffer: bufio.NewWriter(file),
+	}
+
+	var w io.Writer = &countingWriter{w: seg.buffer, n: &seg.size}
+
+	if compress {
+		seg.gzip = gzip.NewWriter(w)
+		w = seg.gzip
+	}
+
+	seg.encoder = json.NewEncoder(w)
+
+	return &seg, nil
+}
+
+func (seg *segment) write(record *Record) error {
+	if err := seg.encoder.Encode(record); err != nil {
+		return err
+	}
+
+	c := cursor{lastModified: record.LastModified, postNumber: record.PostNumber}
+
+	if seg.records == 0 || c.before(seg.from) {
+		seg.from = c
+	}
+
+	if seg.records == 0 || seg.to.before(c) {
+		seg.to = c
+	}
+
+	seg.records++
+
+	return nil
+}
+
+//commit flushes the segment to disk and renames it after
+//the cursor range it covers. Segments covering a range some
+//file is already named after, as happens when a pass is
+//retried, get the first sequence number free added to it.
+func (seg *segment) commit() error {
+	if seg.gzip != nil {
+		if err := seg.gzip.Close(); err != nil {
+			return err
+		}
+	}
+
+	if err := seg.buffer.Flush(); err != nil {
+		return err
+	}
+
+	if err := seg.file.Sync(); err != nil {
+		return err
+	}
+
+	if err := seg.file.Close(); err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(seg.file.Name())
+
+	for seq := 0; ; seq++ {
+		err := os.Link(seg.file.Name(), filepath.Join(dir, seg.name(seq)))
+
+		if err == nil {
+			return os.Remove(seg.file.Name())
+		}
+
+		if !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	}
+}
+
+//name returns the name of the segment once committed,
+//with the sequence number passed unless it's 0
+func (seg *segment) name(seq int) string {
+	name := fmt.Sprintf("%s-%s", seg.from, seg.to)
+
+	if seq > 0 {
+		name += fmt.Sprintf(".%d", seq)
+	}
+
+	name += ".ndjson"
+
+	if seg.gzip != nil {
+		name += ".gz"
+	}
+
+	return name
+}
+
+//discard closes and removes the segment
+func (seg *segment) discard() error {
+	seg.file.Close()
+	return os.Remove(seg.file.Name())
+}
+
+//countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	*cw.n += int64(n)
+	return n, err
+}
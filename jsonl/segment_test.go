@@ -0,0 +1,115 @@
+package jsonl
+
+import (
+	"compress/gzip"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeSegment(t *testing.T, dir string, compress bool, records ...Record) *segment {
+	t.Helper()
+
+	seg, err := newSegment(dir, compress)
+
+	if err != nil {
+		t.Fatalf("newSegment() failed: %s", err)
+	}
+
+	for i := range records {
+		if err := seg.write(&records[i]); err != nil {
+			t.Fatalf("write() failed: %s", err)
+		}
+	}
+
+	return seg
+}
+
+func committedNames(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		t.Fatalf("Error reading %s: %s", dir, err)
+	}
+
+	names := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func TestCommitKeepsSegmentsOfTheSameRange(t *testing.T) {
+	dir := t.TempDir()
+	records := []Record{
+		{Action: "upsert", Board: "a", PostNumber: 1, LastModified: time.Unix(1, 0)},
+		{Action: "upsert", Board: "a", PostNumber: 2, LastModified: time.Unix(2, 0)},
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := writeSegment(t, dir, false, records...).commit(); err != nil {
+			t.Fatalf("commit() failed: %s", err)
+		}
+	}
+
+	name := "19700101T000001.000000Z_1-19700101T000002.000000Z_2"
+	want := fmt.Sprint([]string{name + ".1.ndjson", name + ".2.ndjson", name + ".ndjson"})
+
+	if names := fmt.Sprint(committedNames(t, dir)); names != want {
+		t.Errorf("Committed %s, want %s", names, want)
+	}
+}
+
+func TestSegmentSizeIsCompressed(t *testing.T) {
+	dir := t.TempDir()
+	records := make([]Record, 0, 1000)
+
+	for i := 0; i < 1000; i++ {
+		records = append(records, Record{Action: "delete", Board: "a", PostNumber: rand.Int63(), LastModified: time.Unix(int64(i), 0)})
+	}
+
+	seg := writeSegment(t, dir, true, records...)
+
+	if err := seg.commit(); err != nil {
+		t.Fatalf("commit() failed: %s", err)
+	}
+
+	names := committedNames(t, dir)
+
+	if len(names) != 1 || !strings.HasSuffix(names[0], ".ndjson.gz") {
+		t.Fatalf("Committed %v, want a single gzipped segment", names)
+	}
+
+	file, err := os.Open(filepath.Join(dir, names[0]))
+
+	if err != nil {
+		t.Fatalf("Error opening segment: %s", err)
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+
+	if err != nil {
+		t.Fatalf("Error reading segment size: %s", err)
+	}
+
+	if seg.size != info.Size() {
+		t.Errorf("Segment size = %d, want the %d bytes written to disk", seg.size, info.Size())
+	}
+
+	if _, err := gzip.NewReader(file); err != nil {
+		t.Errorf("Segment isn't gzipped: %s", err)
+	}
+}
@@ -0,0 +1,210 @@
+package jsonl
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"moon/config"
+	"moon/db"
+	"moon/lnx"
+	"moon/sink"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var _ sink.Sink = (*Service)(nil)
+var _ sink.Schemaless = (*Service)(nil)
+
+//Service exports posts into one directory of NDJSON files
+//per index. Records are written to pending segments which
+//only get their final names on Commit, so consumers never
+//see data the index tracker hasn't advanced past.
+type Service struct {
+	dir         string
+	compress    bool
+	maxFileSize int64
+
+	mutex    sync.Mutex
+	segments map[string][]*segment
+}
+
+//NewService constructs and returns a Service
+func NewService(conf config.JSONLConfig) *Service {
+	maxFileSize := conf.MaxFileSize
+
+	if maxFileSize <= 0 {
+		maxFileSize = 100 * 1024 * 1024
+	}
+
+	return &Service{
+		dir:         conf.Dir,
+		compress:    conf.Gzip,
+		maxFileSize: maxFileSize,
+		segments:    make(map[string][]*segment),
+	}
+}
+
+//Upsert writes an upsert record for every post, or a
+//delete record if the post is hidden
+func (s *Service) Upsert(ctx context.Context, posts []db.Post, index string, previousScrape time.Time) error {
+	records := make([]Record, 0, len(posts))
+
+	for i := range posts {
+		record := Record{
+			Action:       "upsert",
+			Board:        posts[i].Board,
+			PostNumber:   posts[i].PostNumber,
+			LastModified: posts[i].LastModified,
+		}
+
+		if posts[i].Hidden {
+			record.Action = "delete"
+		} else {
+			lnxPost := lnx.DbPostToLnxPost(&posts[i])
+			record.Post = &lnxPost
+		}
+
+		records = append(records, record)
+	}
+
+	return s.write(index, records)
+}
+
+//Delete writes a delete record for every post
+func (s *Service) Delete(ctx context.Context, posts []db.Post, index string) error {
+	records := make([]Record, 0, len(posts))
+
+	for _, p := range posts {
+		records = append(records, Record{
+			Action:       "delete",
+			Board:        p.Board,
+			PostNumber:   p.PostNumber,
+			LastModified: p.LastModified,
+		})
+	}
+
+	return s.write(index, records)
+}
+
+//Commit gives every pending segment of the
+//index its final name
+func (s *Service) Commit(ctx context.Context, index string) error {
+	s.mutex.Lock()
+	segments := s.segments[index]
+	delete(s.segments, index)
+	s.mutex.Unlock()
+
+	for i, seg := range segments {
+		if err := seg.commit(); err != nil {
+			for _, rest := range segments[i+1:] {
+				rest.discard()
+			}
+
+			return fmt.Errorf("Error committing index %s: %w", index, err)
+		}
+	}
+
+	return nil
+}
+
+//Rollback removes every pending segment of the index
+func (s *Service) Rollback(ctx context.Context, index string) error {
+	s.mutex.Lock()
+	segments := s.segments[index]
+	delete(s.segments, index)
+	s.mutex.Unlock()
+
+	for _, seg := range segments {
+		if err := seg.discard(); err != nil {
+			return fmt.Errorf("Error rolling back index %s: %w", index, err)
+		}
+	}
+
+	return nil
+}
+
+//CreateIndex creates the directory of the index and
+//removes segments left pending by a previous run
+func (s *Service) CreateIndex(ctx context.Context, index string, conf config.BoardConfig) error {
+	indexDir := filepath.Join(s.dir, index)
+
+	if err := os.MkdirAll(indexDir, 0o755); err != nil {
+		return fmt.Errorf("Error creating directory %s: %w", indexDir, err)
+	}
+
+	pending, err := filepath.Glob(filepath.Join(indexDir, "*.pending"))
+
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pending {
+		slog.Info("Removing leftover segment", "sink", "jsonl", "path", p)
+
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//DropIndex keeps the directory of the index around, as
+//consumers may not have read every file in it yet
+func (s *Service) DropIndex(ctx context.Context, index string) error {
+	slog.Info("Leaving directory in place", "sink", "jsonl", "index", index, "path", filepath.Join(s.dir, index))
+	return nil
+}
+
+//Count is unsupported, as exported files are never read back
+func (s *Service) Count(ctx context.Context, index string) (int64, error) {
+	return 0, sink.ErrUnsupported
+}
+
+//Schemaless reports the schema is ignored, as every
+//field of the posts is exported whatever it says
+func (s *Service) Schemaless() bool {
+	return true
+}
+
+//write appends records to the current segment of the index,
+//rotating it once it grows past the maximum file size
+func (s *Service) write(index string, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	segments := s.segments[index]
+
+	var seg *segment
+
+	if len(segments) > 0 {
+		seg = segments[len(segments)-1]
+	}
+
+	for i := range records {
+		if seg == nil || seg.size >= s.maxFileSize {
+			var err error
+
+			seg, err = newSegment(filepath.Join(s.dir, index), s.compress)
+
+			if err != nil {
+				return fmt.Errorf("Error creating segment for index %s: %w", index, err)
+			}
+
+			segments = append(segments, seg)
+			s.segments[index] = segments
+		}
+
+		if err := seg.write(&records[i]); err != nil {
+			return fmt.Errorf("Error writing index %s: %w", index, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package lnx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"moon/sink"
+	"net/http"
+	"strings"
+)
+
+//maxBodySize is how much of the body of a failed
+//response is kept for logs and errors
+const maxBodySize = 4096
+
+//Kind classifies the failures of requests to Lnx
+type Kind int
+
+const (
+	//KindTransient is a failure to reach Lnx, or a server error
+	//that is expected to go away by itself
+	KindTransient Kind = iota
+	//KindOverload means Lnx is busy and should be given time
+	KindOverload
+	//KindIndexMissing means the index requested doesn't exist
+	KindIndexMissing
+	//KindValidation means Lnx refused the request, usually
+	//because a document doesn't match the schema of the index
+	KindValidation
+	//KindUnauthorized means Lnx, or a proxy in front of
+	//it, refused the request for lack of credentials
+	KindUnauthorized
+	//KindRequest means Lnx refused the request for reasons
+	//unrelated to its documents, like its size
+	KindRequest
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindTransient:
+		return "transient"
+	case KindOverload:
+		return "overload"
+	case KindIndexMissing:
+		return "index missing"
+	case KindValidation:
+		return "validation"
+	case KindUnauthorized:
+		return "unauthorized"
+	case KindRequest:
+		return "request"
+	default:
+		return "unknown"
+	}
+}
+
+//Error is a request to Lnx that failed
+type Error struct {
+	Kind     Kind
+	Endpoint string
+	Index    string
+
+	//Status is the status code Lnx responded with, zero if it
+	//couldn't be reached, in which case Err is set instead
+	Status int
+	//Message is what Lnx said went wrong
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("Lnx %s request on index %s failed (%s): %s", e.Endpoint, e.Index, e.Kind, e.Err)
+	}
+
+	message := e.Message
+
+	if message == "" {
+		message = http.StatusText(e.Status)
+	}
+
+	return fmt.Sprintf("Lnx %s request on index %s received status %d (%s): %s", e.Endpoint, e.Index, e.Status, e.Kind, message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+//Retryable reports whether the request may succeed if sent again
+func (e *Error) Retryable() bool {
+	return e.Kind == KindTransient || e.Kind == KindOverload
+}
+
+//Is makes validation errors of document insertions match
+//sink.ErrRejected, as only those are about the posts sent
+func (e *Error) Is(target error) bool {
+	return target == sink.ErrRejected && e.Kind == KindValidation && e.Endpoint == "documents"
+}
+
+//IsKind reports whether err is a failed request to Lnx of the kind passed
+func IsKind(err error, kind Kind) bool {
+	var lnxErr *Error
+	return errors.As(err, &lnxErr) && lnxErr.Kind == kind
+}
+
+//errorResponse is the body Lnx responds with on failures
+type errorResponse struct {
+	Status int             `json:"status"`
+	Data   json.RawMessage `json:"data"`
+}
+
+//transportError wraps a failure to reach Lnx at all
+func transportError(endpoint string, index string, err error) *Error {
+	return &Error{
+		Kind:     KindTransient,
+		Endpoint: endpoint,
+		Index:    index,
+		Err:      err,
+	}
+}
+
+//responseError reads the body of a response Lnx failed a
+//request with, logs it and classifies the failure
+func responseError(resp *http.Response, endpoint string, index string) *Error {
+	return statusError(resp.StatusCode, readMessage(resp), endpoint, index)
+}
+
+//statusError logs and classifies a failure Lnx responded
+//to a request with, given the message it read
+func statusError(status int, message string, endpoint string, index string) *Error {
+	err := &Error{
+		Kind:     classify(status, message),
+		Endpoint: endpoint,
+		Index:    index,
+		Status:   status,
+		Message:  message,
+	}
+
+	slog.Error("Lnx request failed",
+		"endpoint", endpoint,
+		"index", index,
+		"status", status,
+		"kind", err.Kind.String(),
+		"body", message,
+	)
+
+	return err
+}
+
+//classify tells the kind of a failure from the status
+//code and message of the response
+func classify(status int, message string) Kind {
+	lower := strings.ToLower(message)
+
+	switch {
+	case status == http.StatusNotFound:
+		return KindIndexMissing
+	case strings.Contains(lower, "index") && (strings.Contains(lower, "not exist") || strings.Contains(lower, "not found") || strings.Contains(lower, "no index")):
+		return KindIndexMissing
+	case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable:
+		return KindOverload
+	case status >= 500:
+		return KindTransient
+	case status == http.StatusBadRequest || status == http.StatusUnprocessableEntity:
+		return KindValidation
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return KindUnauthorized
+	default:
+		return KindRequest
+	}
+}
+
+//readMessage reads and closes the body of a response, keeping
+//up to maxBodySize bytes of it, and returns the message in it
+func readMessage(resp *http.Response) string {
+	defer resp.Body.Close()
+
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+
+	var errorResponse errorResponse
+
+	if err := json.Unmarshal(b, &errorResponse); err == nil && len(errorResponse.Data) > 0 {
+		var message string
+
+		if err := json.Unmarshal(errorResponse.Data, &message); err == nil {
+			return message
+		}
+
+		return string(errorResponse.Data)
+	}
+
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,101 @@
+package lnx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"moon/sink"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		status  int
+		message string
+		kind    Kind
+	}{
+		{404, "", KindIndexMissing},
+		{400, "Index post_a does not exist", KindIndexMissing},
+		{400, "no index named post_a", KindIndexMissing},
+		{429, "", KindOverload},
+		{503, "", KindOverload},
+		{500, "panicked", KindTransient},
+		{502, "", KindTransient},
+		{400, "field ts is required", KindValidation},
+		{422, "expected i64", KindValidation},
+		{401, "", KindUnauthorized},
+		{403, "", KindUnauthorized},
+		{413, "payload too large", KindRequest},
+		{405, "", KindRequest},
+	}
+
+	for _, test := range tests {
+		if kind := classify(test.status, test.message); kind != test.kind {
+			t.Errorf("classify(%d, %q) = %s, want %s", test.status, test.message, kind, test.kind)
+		}
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		body    string
+		message string
+	}{
+		{`{"status": 400, "data": "missing field ts"}`, "missing field ts"},
+		{`{"status": 400, "data": {"field": "ts"}}`, `{"field": "ts"}`},
+		{"  bad gateway\n", "bad gateway"},
+		{"", ""},
+		{strings.Repeat("a", maxBodySize+100), strings.Repeat("a", maxBodySize)},
+	}
+
+	for _, test := range tests {
+		resp := &http.Response{Body: io.NopCloser(strings.NewReader(test.body))}
+
+		if message := readMessage(resp); message != test.message {
+			t.Errorf("readMessage(%.20q) = %.20q, want %.20q", test.body, message, test.message)
+		}
+	}
+}
+
+func TestErrorIsRejected(t *testing.T) {
+	tests := []struct {
+		err      *Error
+		rejected bool
+	}{
+		{&Error{Kind: KindValidation, Endpoint: "documents", Status: 400}, true},
+		{&Error{Kind: KindValidation, Endpoint: "documents/query", Status: 400}, false},
+		{&Error{Kind: KindRequest, Endpoint: "documents", Status: 413}, false},
+		{&Error{Kind: KindUnauthorized, Endpoint: "documents", Status: 401}, false},
+		{&Error{Kind: KindTransient, Endpoint: "documents", Err: io.EOF}, false},
+	}
+
+	for _, test := range tests {
+		wrapped := fmt.Errorf("Error upserting posts: %w", test.err)
+
+		if rejected := errors.Is(wrapped, sink.ErrRejected); rejected != test.rejected {
+			t.Errorf("errors.Is(%q, sink.ErrRejected) = %t, want %t", wrapped, rejected, test.rejected)
+		}
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := &Error{Kind: KindOverload, Endpoint: "commit", Index: "post_a", Status: 503}
+	want := "Lnx commit request on index post_a received status 503 (overload): Service Unavailable"
+
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	err.Message = "busy"
+	want = "Lnx commit request on index post_a received status 503 (overload): busy"
+
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	if !IsKind(fmt.Errorf("Error committing: %w", err), KindOverload) {
+		t.Error("IsKind doesn't see through wrapping")
+	}
+}
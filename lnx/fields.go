@@ -0,0 +1,152 @@
+package lnx
+
+//PostFields are the default fields of the index every
+//board gets, matching what a Post is marshalled into
+var PostFields = map[string]IndexField{
+	"post_number": {
+		Type:     "i64",
+		Stored:   true,
+		Indexed:  true,
+		Fast:     true,
+		Required: true,
+	},
+	"thread_number": {
+		Type:     "i64",
+		Stored:   false,
+		Indexed:  true,
+		Fast:     false,
+		Required: true,
+	},
+	"op": {
+		Type:     "i64",
+		Stored:   false,
+		Indexed:  true,
+		Fast:     false,
+		Required: true,
+	},
+	"deleted": {
+		Type:     "i64",
+		Stored:   false,
+		Indexed:  true,
+		Fast:     false,
+		Required: true,
+	},
+	"time_posted": {
+		Type:     "date",
+		Stored:   false,
+		Indexed:  true,
+		Fast:     false,
+		Required: true,
+	},
+	"name": {
+		Type:     "text",
+		Stored:   false,
+		Indexed:  true,
+		Required: false,
+	},
+	"tripcode": {
+		Type:     "string",
+		Stored:   false,
+		Indexed:  true,
+		Required: false,
+	},
+	"capcode": {
+		Type:     "string",
+		Stored:   false,
+		Indexed:  true,
+		Required: false,
+	},
+	"poster_id": {
+		Type:     "string",
+		Stored:   false,
+		Indexed:  true,
+		Required: false,
+	},
+	"country": {
+		Type:     "string",
+		Stored:   false,
+		Indexed:  true,
+		Required: false,
+	},
+	"flag": {
+		Type:     "string",
+		Stored:   false,
+		Indexed:  true,
+		Required: false,
+	},
+	"email": {
+		Type:     "string",
+		Stored:   false,
+		Indexed:  true,
+		Required: false,
+	},
+	"subject": {
+		Type:     "text",
+		Stored:   false,
+		Indexed:  true,
+		Required: false,
+	},
+	"comment": {
+		Type:     "text",
+		Stored:   false,
+		Indexed:  true,
+		Required: false,
+	},
+	"has_media": {
+		Type:     "i64",
+		Stored:   false,
+		Indexed:  true,
+		Fast:     false,
+		Required: true,
+	},
+	"media_deleted": {
+		Type:     "i64",
+		Stored:   false,
+		Indexed:  true,
+		Fast:     false,
+		Required: false,
+	},
+	"media_4chan_hash": {
+		Type:     "string",
+		Stored:   false,
+		Indexed:  true,
+		Required: false,
+	},
+	"media_extension": {
+		Type:     "string",
+		Stored:   false,
+		Indexed:  true,
+		Required: false,
+	},
+	"media_file_name": {
+		Type:     "text",
+		Stored:   false,
+		Indexed:  true,
+		Required: false,
+	},
+	"spoiler": {
+		Type:     "i64",
+		Stored:   false,
+		Indexed:  true,
+		Fast:     false,
+		Required: false,
+	},
+	"sticky": {
+		Type:     "i64",
+		Stored:   false,
+		Indexed:  true,
+		Fast:     false,
+		Required: false,
+	},
+	"since4pass": {
+		Type:     "i64",
+		Stored:   false,
+		Indexed:  true,
+		Fast:     false,
+		Required: false,
+	},
+}
+
+//PostSearchFields are the default fields searched
+//when a query doesn't target a specific one
+var PostSearchFields = []string{"comment", "subject", "name", "media_file_name"}
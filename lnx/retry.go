@@ -0,0 +1,99 @@
+package lnx
+
+import (
+	"math/rand"
+	"moon/config"
+	"time"
+)
+
+//retryPolicy decides which failed requests are
+//retried and how long to wait before every attempt
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	jitter      float64
+
+	//retryableStatuses are the status codes worth retrying,
+	//nil to go by the kind of failure instead
+	retryableStatuses map[int]bool
+
+	//deadline is how long a request may be retried for
+	//since it was first sent, zero for no limit
+	deadline time.Duration
+}
+
+//newRetryPolicy builds the retry policy configured,
+//falling back to defaults for settings missing
+func newRetryPolicy(conf config.LnxRetryConfig) retryPolicy {
+	maxAttempts := conf.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 4
+	}
+
+	baseDelay, err := time.ParseDuration(conf.BaseDelay)
+	if err != nil || baseDelay <= 0 {
+		baseDelay = time.Second
+	}
+
+	maxDelay, err := time.ParseDuration(conf.MaxDelay)
+	if err != nil || maxDelay < baseDelay {
+		maxDelay = time.Minute
+	}
+
+	jitter := 0.2
+	if conf.Jitter != nil {
+		jitter = min(max(*conf.Jitter, 0), 1)
+	}
+
+	var retryableStatuses map[int]bool
+
+	if conf.RetryableStatuses != nil {
+		retryableStatuses = make(map[int]bool, len(conf.RetryableStatuses))
+
+		for _, status := range conf.RetryableStatuses {
+			retryableStatuses[status] = true
+		}
+	}
+
+	deadline, err := time.ParseDuration(conf.Deadline)
+	if err != nil || deadline < 0 {
+		deadline = 5 * time.Minute
+	}
+
+	return retryPolicy{
+		maxAttempts:       maxAttempts,
+		baseDelay:         baseDelay,
+		maxDelay:          maxDelay,
+		jitter:            jitter,
+		retryableStatuses: retryableStatuses,
+		deadline:          deadline,
+	}
+}
+
+//retryable reports whether a request that failed with err
+//should be sent again. Lnx being unreachable always is.
+func (p retryPolicy) retryable(err *Error) bool {
+	if err.Status == 0 || p.retryableStatuses == nil {
+		return err.Retryable()
+	}
+
+	return p.retryableStatuses[err.Status]
+}
+
+//delay returns how long to wait before the attempt following
+//the one passed, counting from zero. It doubles every attempt
+//up to maxDelay, less a random share of up to jitter of it.
+func (p retryPolicy) delay(attempt int) time.Duration {
+	delay := p.baseDelay
+
+	for i := 0; i < attempt && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+
+	return delay - time.Duration(rand.Float64()*p.jitter*float64(delay))
+}
@@ -0,0 +1,79 @@
+package lnx
+
+import (
+	"errors"
+	"moon/config"
+	"testing"
+	"time"
+)
+
+func TestNewRetryPolicyDefaults(t *testing.T) {
+	p := newRetryPolicy(config.LnxRetryConfig{BaseDelay: "nonsense", MaxDelay: "1ms"})
+
+	if p.maxAttempts != 4 || p.baseDelay != time.Second || p.maxDelay != time.Minute || p.jitter != 0.2 || p.deadline != 5*time.Minute {
+		t.Errorf("newRetryPolicy fell back to %+v", p)
+	}
+
+	if p.retryableStatuses != nil {
+		t.Errorf("retryableStatuses = %v, want nil", p.retryableStatuses)
+	}
+
+	jitter := 3.0
+	p = newRetryPolicy(config.LnxRetryConfig{Jitter: &jitter, Deadline: "0s"})
+
+	if p.jitter != 1 || p.deadline != 0 {
+		t.Errorf("jitter = %f and deadline = %s, want 1 and 0s", p.jitter, p.deadline)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	p := retryPolicy{baseDelay: time.Second, maxDelay: 10 * time.Second}
+
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if delay := p.delay(attempt); delay != want {
+			t.Errorf("delay(%d) = %s, want %s", attempt, delay, want)
+		}
+	}
+
+	if delay := p.delay(1000); delay != p.maxDelay {
+		t.Errorf("delay(1000) = %s, want %s", delay, p.maxDelay)
+	}
+}
+
+func TestDelayJitter(t *testing.T) {
+	p := retryPolicy{baseDelay: time.Second, maxDelay: time.Minute, jitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		if delay := p.delay(2); delay < 2*time.Second || delay > 4*time.Second {
+			t.Fatalf("delay(2) = %s, want between 2s and 4s", delay)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	byKind := retryPolicy{}
+	byStatus := retryPolicy{retryableStatuses: map[int]bool{500: true, 409: true}}
+
+	tests := []struct {
+		err      *Error
+		byKind   bool
+		byStatus bool
+	}{
+		{&Error{Kind: KindTransient, Err: errors.New("connection refused")}, true, true},
+		{&Error{Kind: KindTransient, Status: 500}, true, true},
+		{&Error{Kind: KindTransient, Status: 502}, true, false},
+		{&Error{Kind: KindOverload, Status: 503}, true, false},
+		{&Error{Kind: KindRequest, Status: 409}, false, true},
+		{&Error{Kind: KindValidation, Status: 400}, false, false},
+	}
+
+	for _, test := range tests {
+		if retryable := byKind.retryable(test.err); retryable != test.byKind {
+			t.Errorf("retryable(%s) by kind = %t, want %t", test.err, retryable, test.byKind)
+		}
+
+		if retryable := byStatus.retryable(test.err); retryable != test.byStatus {
+			t.Errorf("retryable(%s) by status = %t, want %t", test.err, retryable, test.byStatus)
+		}
+	}
+}
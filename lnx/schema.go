@@ -0,0 +1,170 @@
+package lnx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"moon/config"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//Schema is the layout of the index a board gets
+type Schema struct {
+	Fields                  map[string]IndexField
+	SearchFields            []string
+	StripStopWords          bool
+	SetConjunctionByDefault bool
+}
+
+//NewSchema applies the overrides in conf to the default
+//schema and validates the result against the fields a
+//Post is marshalled into
+func NewSchema(conf config.SchemaConfig) (Schema, error) {
+	schema := Schema{
+		Fields:                  make(map[string]IndexField, len(PostFields)),
+		SearchFields:            PostSearchFields,
+		StripStopWords:          false,
+		SetConjunctionByDefault: true,
+	}
+
+	for name, field := range PostFields {
+		schema.Fields[name] = field
+	}
+
+	postTypes := postFieldTypes()
+
+	for name, fieldConf := range conf.Fields {
+		goType, ok := postTypes[name]
+
+		if !ok {
+			return Schema{}, fmt.Errorf("Unknown field %s", name)
+		}
+
+		field := schema.Fields[name]
+
+		if fieldConf.Type != "" {
+			if !contains(allowedTypes(goType), fieldConf.Type) {
+				return Schema{}, fmt.Errorf("Field %s can't be of type %s, only one of %s", name, fieldConf.Type, strings.Join(allowedTypes(goType), ", "))
+			}
+
+			field.Type = fieldConf.Type
+		}
+
+		if fieldConf.Stored != nil {
+			field.Stored = *fieldConf.Stored
+		}
+
+		if fieldConf.Indexed != nil {
+			field.Indexed = *fieldConf.Indexed
+		}
+
+		if fieldConf.Fast != nil {
+			field.Fast = *fieldConf.Fast
+		}
+
+		if fieldConf.Required != nil {
+			if *fieldConf.Required && goType.Kind() == reflect.Ptr {
+				return Schema{}, fmt.Errorf("Field %s can't be required, as posts may not have it", name)
+			}
+
+			field.Required = *fieldConf.Required
+		}
+
+		schema.Fields[name] = field
+	}
+
+	//Posts are deleted, counted and verified by post number,
+	//so it has to stay an indexed and stored integer
+	if postNumber := schema.Fields["post_number"]; postNumber.Type != "i64" || !postNumber.Indexed || !postNumber.Stored {
+		return Schema{}, fmt.Errorf("Field post_number has to stay an indexed and stored i64")
+	}
+
+	if conf.SearchFields != nil {
+		schema.SearchFields = conf.SearchFields
+	}
+
+	if len(schema.SearchFields) == 0 {
+		return Schema{}, fmt.Errorf("At least one search field is required")
+	}
+
+	for _, name := range schema.SearchFields {
+		field, ok := schema.Fields[name]
+
+		if !ok {
+			return Schema{}, fmt.Errorf("Unknown search field %s", name)
+		}
+
+		if field.Type != "text" && field.Type != "string" {
+			return Schema{}, fmt.Errorf("Search field %s is of type %s instead of text or string", name, field.Type)
+		}
+
+		if !field.Indexed {
+			return Schema{}, fmt.Errorf("Search field %s isn't indexed", name)
+		}
+	}
+
+	if conf.StripStopWords != nil {
+		schema.StripStopWords = *conf.StripStopWords
+	}
+
+	if conf.SetConjunctionByDefault != nil {
+		schema.SetConjunctionByDefault = *conf.SetConjunctionByDefault
+	}
+
+	return schema, nil
+}
+
+//Fingerprint hashes the schema, so indexes created
+//from different schemas can be told apart
+func (s Schema) Fingerprint() string {
+	b, _ := json.Marshal(s)
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:])
+}
+
+//postFieldTypes maps the JSON name of every field
+//of a Post to its Go type
+func postFieldTypes() map[string]reflect.Type {
+	t := reflect.TypeOf(Post{})
+	types := make(map[string]reflect.Type, t.NumField())
+
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		types[name] = t.Field(i).Type
+	}
+
+	return types
+}
+
+//allowedTypes returns the field types a value
+//of the Go type passed can be indexed as
+func allowedTypes(t reflect.Type) []string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return []string{"date"}
+	case t.Kind() == reflect.Int64:
+		return []string{"i64", "f64"}
+	case t.Kind() == reflect.String:
+		return []string{"text", "string"}
+	default:
+		return nil
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,134 @@
+package lnx
+
+import (
+	"moon/config"
+	"strings"
+	"testing"
+)
+
+func TestNewSchemaDefaults(t *testing.T) {
+	schema, err := NewSchema(config.SchemaConfig{})
+
+	if err != nil {
+		t.Fatalf("NewSchema() failed: %s", err)
+	}
+
+	if len(schema.Fields) != len(PostFields) || len(schema.SearchFields) != len(PostSearchFields) {
+		t.Errorf("NewSchema() has %d fields and %d search fields, want %d and %d", len(schema.Fields), len(schema.SearchFields), len(PostFields), len(PostSearchFields))
+	}
+
+	if schema.Fingerprint() != (Schema{Fields: PostFields, SearchFields: PostSearchFields, SetConjunctionByDefault: true}).Fingerprint() {
+		t.Error("Default schema has a different fingerprint than the default fields")
+	}
+}
+
+func TestNewSchemaOverrides(t *testing.T) {
+	schema, err := NewSchema(config.SchemaConfig{
+		Fields: map[string]config.FieldConfig{
+			"tripcode":    {Type: "text", Indexed: boolPointer(true)},
+			"post_number": {Fast: boolPointer(false)},
+		},
+		SearchFields:   []string{"comment", "tripcode"},
+		StripStopWords: boolPointer(true),
+	})
+
+	if err != nil {
+		t.Fatalf("NewSchema() failed: %s", err)
+	}
+
+	if field := schema.Fields["tripcode"]; field.Type != "text" || !field.Indexed {
+		t.Errorf("tripcode = %+v, want an indexed text field", field)
+	}
+
+	if schema.Fields["post_number"].Fast {
+		t.Error("post_number is still fast")
+	}
+
+	if !schema.StripStopWords || !schema.SetConjunctionByDefault {
+		t.Errorf("StripStopWords = %t and SetConjunctionByDefault = %t, want both set", schema.StripStopWords, schema.SetConjunctionByDefault)
+	}
+
+	if PostFields["tripcode"].Type != "string" {
+		t.Error("NewSchema() changed the default fields")
+	}
+
+	defaults, _ := NewSchema(config.SchemaConfig{})
+
+	if schema.Fingerprint() == defaults.Fingerprint() {
+		t.Error("Overridden schema has the same fingerprint as the default one")
+	}
+}
+
+func TestNewSchemaValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		conf config.SchemaConfig
+		err  string
+	}{
+		{
+			"unknown field",
+			config.SchemaConfig{Fields: map[string]config.FieldConfig{"body": {Type: "text"}}},
+			"Unknown field body",
+		},
+		{
+			"wrong type",
+			config.SchemaConfig{Fields: map[string]config.FieldConfig{"comment": {Type: "i64"}}},
+			"Field comment can't be of type i64",
+		},
+		{
+			"optional field required",
+			config.SchemaConfig{Fields: map[string]config.FieldConfig{"comment": {Required: boolPointer(true)}}},
+			"Field comment can't be required",
+		},
+		{
+			"post_number retyped",
+			config.SchemaConfig{Fields: map[string]config.FieldConfig{"post_number": {Type: "f64"}}},
+			"Field post_number has to stay",
+		},
+		{
+			"post_number not stored",
+			config.SchemaConfig{Fields: map[string]config.FieldConfig{"post_number": {Stored: boolPointer(false)}}},
+			"Field post_number has to stay",
+		},
+		{
+			"post_number not indexed",
+			config.SchemaConfig{Fields: map[string]config.FieldConfig{"post_number": {Indexed: boolPointer(false)}}},
+			"Field post_number has to stay",
+		},
+		{
+			"no search fields",
+			config.SchemaConfig{SearchFields: []string{}},
+			"At least one search field is required",
+		},
+		{
+			"unknown search field",
+			config.SchemaConfig{SearchFields: []string{"body"}},
+			"Unknown search field body",
+		},
+		{
+			"numeric search field",
+			config.SchemaConfig{SearchFields: []string{"thread_number"}},
+			"Search field thread_number is of type i64",
+		},
+		{
+			"search field not indexed",
+			config.SchemaConfig{
+				Fields:       map[string]config.FieldConfig{"comment": {Indexed: boolPointer(false)}},
+				SearchFields: []string{"comment"},
+			},
+			"Search field comment isn't indexed",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := NewSchema(test.conf)
+
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("%s: NewSchema() = %v, want %q", test.name, err, test.err)
+		}
+	}
+}
+
+func boolPointer(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,7 @@
+package lnx
+
+type searchRequest struct {
+	Query  query `json:"query"`
+	Limit  int   `json:"limit"`
+	Offset int   `json:"offset"`
+}
@@ -0,0 +1,45 @@
+package lnx
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+type searchResponse struct {
+	Data searchResponseData `json:"data"`
+}
+
+type searchResponseData struct {
+	Count int64       `json:"count"`
+	Hits  []searchHit `json:"hits"`
+}
+
+type searchHit struct {
+	Doc searchHitDoc `json:"doc"`
+}
+
+type searchHitDoc struct {
+	PostNumber json.RawMessage `json:"post_number"`
+}
+
+//postNumber returns the post number of a hit, which Lnx
+//may return either as a value or as a list of them
+func (d searchHitDoc) postNumber() (int64, error) {
+	var postNumber int64
+
+	if err := json.Unmarshal(d.PostNumber, &postNumber); err == nil {
+		return postNumber, nil
+	}
+
+	var postNumbers []int64
+
+	if err := json.Unmarshal(d.PostNumber, &postNumbers); err != nil {
+		return 0, err
+	}
+
+	if len(postNumbers) == 0 {
+		return 0, errors.New("Hit has no post number")
+	}
+
+	return postNumbers[0], nil
+}
@@ -1,16 +1,32 @@
 package lnx
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"math"
 	"moon/config"
 	"moon/db"
+	"moon/metrics"
+	"moon/sink"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
+var _ sink.Sink = (*Service)(nil)
+var _ sink.Pinger = (*Service)(nil)
+var _ sink.Verifier = (*Service)(nil)
+var _ sink.Prober = (*Service)(nil)
+
+//searchPageSize is how many hits are read at once
+//when listing the posts of an index
+const searchPageSize = 1000
+
 //Service wraps writes and upserts to Lnx
 type Service struct {
 	host           string
@@ -18,6 +34,7 @@ type Service struct {
 	readerThreads  int
 	maxConcurrency int
 	writerBuffer   int
+	retry          retryPolicy
 }
 
 //NewService constructs and returns a Service
@@ -30,11 +47,12 @@ func NewService(conf config.LnxConfig) Service {
 		readerThreads:  conf.ReaderThreads,
 		maxConcurrency: conf.MaxConcurrency,
 		writerBuffer:   conf.WriterBuffer,
+		retry:          newRetryPolicy(conf.Retry),
 	}
 }
 
 //Upsert upserts an array of posts into Lnx
-func (s *Service) Upsert(posts []db.Post, board string, previousScrape time.Time) error {
+func (s *Service) Upsert(ctx context.Context, posts []db.Post, index string, previousScrape time.Time) error {
 	deletables := make([]db.Post, 0, 10)
 
 	for _, p := range posts {
@@ -43,287 +61,112 @@ func (s *Service) Upsert(posts []db.Post, board string, previousScrape time.Time
 		}
 	}
 
-	if len(deletables) > 0 {
-		deleteRequest := buildDeleteRequest(deletables)
+	if err := s.Delete(ctx, deletables, index); err != nil {
+		return err
+	}
+
+	lnxPosts := DbPostsToLnxPosts(posts)
 
-		for i := 0; ; i++ {
-			pipeReader, pipeWriter := io.Pipe()
+	err := s.send(ctx, "documents", index, func(ctx context.Context) *http.Request {
+		pipeReader, pipeWriter := io.Pipe()
 
-			go func() {
-				jsonEncoder := json.NewEncoder(pipeWriter)
-				err := jsonEncoder.Encode(&deleteRequest)
-				pipeWriter.CloseWithError(err)
-			}()
+		go func() {
+			jsonEncoder := json.NewEncoder(pipeWriter)
+			err := jsonEncoder.Encode(&lnxPosts)
+			pipeWriter.CloseWithError(err)
+		}()
 
-			r, _ := http.NewRequest("DELETE", fmt.Sprintf("%s/post_%s/documents/query", s.host, board), pipeReader)
-			resp, err := s.client.Do(r)
+		r, _ := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/%s/documents", s.host, index), pipeReader)
+		r.Header.Set("Content-Type", "application/json")
 
-			if err != nil {
-				if i < 3 {
-					log.Printf("Error performing deletion request: %s", err)
-					time.Sleep(30 * time.Second)
-					continue
-				} else {
-					return fmt.Errorf("Error performing deletion request: %s", err)
-				}
-			}
+		return r
+	})
 
-			resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("Error inserting posts: %w", err)
+	}
 
-			if resp.StatusCode != 200 {
-				return fmt.Errorf("Error deleting old posts: request received status %s", resp.Status)
-			}
+	return nil
+}
 
-			break
-		}
+//Delete deletes an array of posts from Lnx
+func (s *Service) Delete(ctx context.Context, posts []db.Post, index string) error {
+	if len(posts) == 0 {
+		return nil
 	}
 
-	lnxPosts := DbPostsToLnxPosts(posts)
+	deleteRequest := buildDeleteRequest(posts)
 
-	for i := 0; ; i++ {
+	err := s.send(ctx, "documents/query", index, func(ctx context.Context) *http.Request {
 		pipeReader, pipeWriter := io.Pipe()
 
 		go func() {
 			jsonEncoder := json.NewEncoder(pipeWriter)
-			err := jsonEncoder.Encode(&lnxPosts)
+			err := jsonEncoder.Encode(&deleteRequest)
 			pipeWriter.CloseWithError(err)
 		}()
 
-		resp, err := s.client.Post(fmt.Sprintf("%s/post_%s/documents", s.host, board), "application/json", pipeReader)
-
-		if err != nil {
-			if i < 3 {
-				log.Printf("Error performing insertion request: %s", err)
-				time.Sleep(30 * time.Second)
-
-				continue
-			} else {
-				return fmt.Errorf("Error performing insertion request: %s", err)
-			}
-		}
+		r, _ := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("%s/%s/documents/query", s.host, index), pipeReader)
 
-		resp.Body.Close()
-
-		if resp.StatusCode != 200 {
-			return fmt.Errorf("Error inserting posts: request received status %s", resp.Status)
-		}
+		return r
+	})
 
-		break
+	if err != nil {
+		return fmt.Errorf("Error deleting old posts: %w", err)
 	}
 
 	return nil
 }
 
 //Rollback rolls back index modifications
-func (s *Service) Rollback(board string) error {
-	for i := 0; ; i++ {
-		resp, err := s.client.Post(fmt.Sprintf("%s/post_%s/rollback", s.host, board), "", nil)
-
-		if err != nil {
-			if i < 3 {
-				log.Printf("Error performing rollback: %s", err)
-				time.Sleep(30 * time.Second)
-
-				continue
-			} else {
-				return fmt.Errorf("Error performing rollback: %s", err)
-			}
-		}
-
-		resp.Body.Close()
+func (s *Service) Rollback(ctx context.Context, index string) error {
+	err := s.send(ctx, "rollback", index, func(ctx context.Context) *http.Request {
+		r, _ := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/%s/rollback", s.host, index), nil)
+		return r
+	})
 
-		if resp.StatusCode != 200 {
-			return fmt.Errorf("Rollback request received status %s", resp.Status)
-		}
-
-		return nil
+	if err != nil {
+		return fmt.Errorf("Error performing rollback: %w", err)
 	}
+
+	return nil
 }
 
 //Commit commits index modifications
-func (s *Service) Commit(board string) error {
-	for i := 0; ; i++ {
-		resp, err := s.client.Post(fmt.Sprintf("%s/post_%s/commit", s.host, board), "", nil)
-
-		if err != nil {
-			if i < 3 {
-				log.Printf("Error performing commit: %s", err)
-				time.Sleep(30 * time.Second)
+func (s *Service) Commit(ctx context.Context, index string) error {
+	err := s.send(ctx, "commit", index, func(ctx context.Context) *http.Request {
+		r, _ := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/%s/commit", s.host, index), nil)
+		return r
+	})
 
-				continue
-			} else {
-				return fmt.Errorf("Error performing commit: %s", err)
-			}
-		}
+	if err != nil {
+		return fmt.Errorf("Error performing commit: %w", err)
+	}
 
-		resp.Body.Close()
+	return nil
+}
 
-		if resp.StatusCode != 200 {
-			return fmt.Errorf("Request received status %s", resp.Status)
-		}
+//CreateIndex creates the index described by the configuration passed
+func (s *Service) CreateIndex(ctx context.Context, index string, conf config.BoardConfig) error {
+	schema, err := NewSchema(conf.Schema)
 
-		return nil
+	if err != nil {
+		return fmt.Errorf("Error building schema for index %s: %w", index, err)
 	}
-}
 
-//CreateIndex creates the index described by the configuration passed
-func (s *Service) CreateIndex(conf config.BoardConfig) {
 	createIndexRequest := CreateIndexRequest{
-		OverrideIfExists: conf.ForceRecreate,
+		OverrideIfExists: false,
 		Index: CreateIndexRequestIndex{
-			Name:                    fmt.Sprintf("post_%s", conf.Name),
+			Name:                    index,
 			StorageType:             "filesystem",
-			StripStopWords:          false,
-			SetConjunctionByDefault: true,
-			Fields: map[string]IndexField{
-				"post_number": {
-					Type:     "i64",
-					Stored:   true,
-					Indexed:  true,
-					Fast:     true,
-					Required: true,
-				},
-				"thread_number": {
-					Type:     "i64",
-					Stored:   false,
-					Indexed:  true,
-					Fast:     false,
-					Required: true,
-				},
-				"op": {
-					Type:     "i64",
-					Stored:   false,
-					Indexed:  true,
-					Fast:     false,
-					Required: true,
-				},
-				"deleted": {
-					Type:     "i64",
-					Stored:   false,
-					Indexed:  true,
-					Fast:     false,
-					Required: true,
-				},
-				"time_posted": {
-					Type:     "date",
-					Stored:   false,
-					Indexed:  true,
-					Fast:     false,
-					Required: true,
-				},
-				"name": {
-					Type:     "text",
-					Stored:   false,
-					Indexed:  true,
-					Required: false,
-				},
-				"tripcode": {
-					Type:     "string",
-					Stored:   false,
-					Indexed:  true,
-					Required: false,
-				},
-				"capcode": {
-					Type:     "string",
-					Stored:   false,
-					Indexed:  true,
-					Required: false,
-				},
-				"poster_id": {
-					Type:     "string",
-					Stored:   false,
-					Indexed:  true,
-					Required: false,
-				},
-				"country": {
-					Type:     "string",
-					Stored:   false,
-					Indexed:  true,
-					Required: false,
-				},
-				"flag": {
-					Type:     "string",
-					Stored:   false,
-					Indexed:  true,
-					Required: false,
-				},
-				"email": {
-					Type:     "string",
-					Stored:   false,
-					Indexed:  true,
-					Required: false,
-				},
-				"subject": {
-					Type:     "text",
-					Stored:   false,
-					Indexed:  true,
-					Required: false,
-				},
-				"comment": {
-					Type:     "text",
-					Stored:   false,
-					Indexed:  true,
-					Required: false,
-				},
-				"has_media": {
-					Type:     "i64",
-					Stored:   false,
-					Indexed:  true,
-					Fast:     false,
-					Required: true,
-				},
-				"media_deleted": {
-					Type:     "i64",
-					Stored:   false,
-					Indexed:  true,
-					Fast:     false,
-					Required: false,
-				},
-				"media_4chan_hash": {
-					Type:     "string",
-					Stored:   false,
-					Indexed:  true,
-					Required: false,
-				},
-				"media_extension": {
-					Type:     "string",
-					Stored:   false,
-					Indexed:  true,
-					Required: false,
-				},
-				"media_file_name": {
-					Type:     "text",
-					Stored:   false,
-					Indexed:  true,
-					Required: false,
-				},
-				"spoiler": {
-					Type:     "i64",
-					Stored:   false,
-					Indexed:  true,
-					Fast:     false,
-					Required: false,
-				},
-				"sticky": {
-					Type:     "i64",
-					Stored:   false,
-					Indexed:  true,
-					Fast:     false,
-					Required: false,
-				},
-				"since4pass": {
-					Type:     "i64",
-					Stored:   false,
-					Indexed:  true,
-					Fast:     false,
-					Required: false,
-				},
-			},
-			SearchFields:   []string{"comment", "subject", "name", "media_file_name"},
-			ReaderThreads:  s.readerThreads,
-			MaxConcurrency: s.maxConcurrency,
-			WriterBuffer:   s.writerBuffer,
-			WriterThreads:  1,
+			StripStopWords:          schema.StripStopWords,
+			SetConjunctionByDefault: schema.SetConjunctionByDefault,
+			Fields:                  schema.Fields,
+			SearchFields:            schema.SearchFields,
+			ReaderThreads:           s.readerThreads,
+			MaxConcurrency:          s.maxConcurrency,
+			WriterBuffer:            s.writerBuffer,
+			WriterThreads:           1,
 		},
 	}
 
@@ -335,20 +178,229 @@ func (s *Service) CreateIndex(conf config.BoardConfig) {
 		writer.CloseWithError(err)
 	}()
 
-	resp, err := http.Post(s.host, "application/json", reader)
+	r, _ := http.NewRequestWithContext(ctx, "POST", s.host, reader)
+	r.Header.Set("Content-Type", "application/json")
+	resp, err := s.do(r, "create")
 
 	if err != nil {
-		log.Fatalf("Error creating index: %v", err)
+		return fmt.Errorf("Error creating index: %w", transportError("create", index, err))
+	}
+
+	if resp.StatusCode != 200 {
+		message := readMessage(resp)
+
+		if resp.StatusCode == 400 && strings.Contains(strings.ToLower(message), "already exist") {
+			slog.Info("Index already exists", "sink", "lnx", "index", index)
+			return nil
+		}
+
+		return fmt.Errorf("Error creating index: %w", statusError(resp.StatusCode, message, "create", index))
 	}
 
 	resp.Body.Close()
 
-	if resp.StatusCode == 400 {
-		log.Printf("Received status 400 creating index for %s\n", conf.Name)
-		return
+	return nil
+}
+
+//DropIndex deletes an index
+func (s *Service) DropIndex(ctx context.Context, index string) error {
+	r, _ := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("%s/%s", s.host, index), nil)
+	resp, err := s.do(r, "drop")
+
+	if err != nil {
+		return fmt.Errorf("Error deleting index: %w", transportError("drop", index, err))
+	}
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Error deleting index: %w", responseError(resp, "drop", index))
+	}
+
+	resp.Body.Close()
+
+	return nil
+}
+
+//Count returns the number of posts in an index
+func (s *Service) Count(ctx context.Context, index string) (int64, error) {
+	count, err := s.CountRange(ctx, index, 0, math.MaxInt64)
+
+	if err != nil {
+		return 0, fmt.Errorf("Error counting posts: %w", err)
+	}
+
+	return count, nil
+}
+
+//CountRange returns the number of posts in an index
+//numbered from from to to, both included
+func (s *Service) CountRange(ctx context.Context, index string, from int64, to int64) (int64, error) {
+	searchResponse, err := s.search(ctx, index, rangeQuery(from, to), 1, 0)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return searchResponse.Data.Count, nil
+}
+
+//PostNumbers returns the number of every post in an index
+//numbered from from to to, both included, once per copy
+func (s *Service) PostNumbers(ctx context.Context, index string, from int64, to int64) ([]int64, error) {
+	postNumbers := make([]int64, 0)
+
+	for {
+		searchResponse, err := s.search(ctx, index, rangeQuery(from, to), searchPageSize, len(postNumbers))
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hit := range searchResponse.Data.Hits {
+			postNumber, err := hit.Doc.postNumber()
+
+			if err != nil {
+				return nil, fmt.Errorf("Error reading search hit: %w", err)
+			}
+
+			postNumbers = append(postNumbers, postNumber)
+		}
+
+		if len(searchResponse.Data.Hits) < searchPageSize || int64(len(postNumbers)) >= searchResponse.Data.Count {
+			return postNumbers, nil
+		}
+	}
+}
+
+//search runs a query against an index
+func (s *Service) search(ctx context.Context, index string, q string, limit int, offset int) (searchResponse, error) {
+	var searchResponse searchResponse
+
+	b, err := json.Marshal(&searchRequest{
+		Query:  query{normalQuery{Ctx: q}},
+		Limit:  limit,
+		Offset: offset,
+	})
+
+	if err != nil {
+		return searchResponse, err
+	}
+
+	r, _ := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/%s/search", s.host, index), bytes.NewReader(b))
+	r.Header.Set("Content-Type", "application/json")
+	resp, err := s.do(r, "search")
+
+	if err != nil {
+		return searchResponse, transportError("search", index, err)
 	}
 
 	if resp.StatusCode != 200 {
-		log.Fatalf("Received status %s creating index\n", resp.Status)
+		return searchResponse, responseError(resp, "search", index)
+	}
+
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(&searchResponse); err != nil {
+		return searchResponse, fmt.Errorf("Error decoding search response: %w", err)
 	}
+
+	return searchResponse, nil
+}
+
+//rangeQuery matches the posts numbered from from to to, both included
+func rangeQuery(from int64, to int64) string {
+	return fmt.Sprintf("post_number:[%d TO %d]", from, to)
+}
+
+//Probe checks an index exists by looking up a single post
+//number, which is much cheaper than counting every post
+func (s *Service) Probe(ctx context.Context, index string) error {
+	_, err := s.search(ctx, index, "post_number:0", 1, 0)
+	return err
+}
+
+//Ping checks Lnx can be reached
+func (s *Service) Ping(ctx context.Context) error {
+	r, _ := http.NewRequestWithContext(ctx, "GET", s.host, nil)
+	resp, err := s.do(r, "ping")
+
+	if err != nil {
+		return fmt.Errorf("Error reaching Lnx: %w", err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("Lnx responded with status %s", resp.Status)
+	}
+
+	return nil
+}
+
+//send performs the request built by newRequest, which is called
+//again with the context of every attempt, retrying failures as
+//the retry policy says until it gives up or ctx is done
+func (s *Service) send(ctx context.Context, endpoint string, index string, newRequest func(ctx context.Context) *http.Request) error {
+	if s.retry.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.retry.deadline)
+		defer cancel()
+	}
+
+	for attempt := 0; ; attempt++ {
+		var lnxErr *Error
+
+		resp, err := s.do(newRequest(ctx), endpoint)
+
+		if err != nil {
+			lnxErr = transportError(endpoint, index, err)
+		} else if resp.StatusCode != 200 {
+			lnxErr = responseError(resp, endpoint, index)
+		} else {
+			resp.Body.Close()
+			return nil
+		}
+
+		if !s.retry.retryable(lnxErr) || attempt+1 >= s.retry.maxAttempts || ctx.Err() != nil {
+			return lnxErr
+		}
+
+		delay := s.retry.delay(attempt)
+
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return lnxErr
+		}
+
+		slog.Warn("Retrying Lnx request",
+			"endpoint", endpoint,
+			"index", index,
+			"kind", lnxErr.Kind.String(),
+			"attempt", attempt+1,
+			"delay", delay,
+			"error", lnxErr,
+		)
+
+		metrics.LnxRetries.WithLabelValues(endpoint).Inc()
+
+		if err := sleep(ctx, delay); err != nil {
+			return lnxErr
+		}
+	}
+}
+
+//do performs a request, recording its latency and status
+//code under the endpoint passed
+func (s *Service) do(r *http.Request, endpoint string) (*http.Response, error) {
+	start := time.Now()
+	resp, err := s.client.Do(r)
+
+	metrics.LnxRequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		metrics.LnxRequests.WithLabelValues(endpoint, "error").Inc()
+		return nil, err
+	}
+
+	metrics.LnxRequests.WithLabelValues(endpoint, strconv.Itoa(resp.StatusCode)).Inc()
+
+	return resp, nil
 }
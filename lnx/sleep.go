@@ -0,0 +1,20 @@
+package lnx
+
+import (
+	"context"
+	"time"
+)
+
+//sleep waits for d to pass, returning early
+//with an error if ctx is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
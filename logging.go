@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"moon/config"
+	"os"
+	"strings"
+)
+
+//setupLogging makes every log go to stderr in the
+//format and from the level configured
+func setupLogging(conf config.LogConfig) error {
+	var level slog.Level
+
+	if conf.Level != "" {
+		if err := level.UnmarshalText([]byte(conf.Level)); err != nil {
+			return fmt.Errorf("Invalid log level %s", conf.Level)
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+
+	switch strings.ToLower(conf.Format) {
+	case "", "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	case "logfmt", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("Invalid log format %s, expected json or logfmt", conf.Format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+
+	return nil
+}
+
+//fatal logs an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
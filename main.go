@@ -3,151 +3,242 @@ package main
 import (
 	"context"
 	"database/sql"
-	"log"
+	"flag"
+	"fmt"
+	"io"
+	"moon/bleve"
 	"moon/config"
-	"moon/db"
+	"moon/elasticsearch"
+	"moon/jsonl"
 	"moon/lnx"
-	"time"
+	"moon/meilisearch"
+	"moon/sink"
+	"moon/typesense"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect/pgdialect"
 	"github.com/uptrace/bun/driver/pgdriver"
 )
 
+//command is a Moon subcommand
+type command struct {
+	usage       string
+	description string
+	run         func(ctx context.Context, conf config.Config, pg *bun.DB, args []string) error
+}
+
+//commands are the subcommands Moon supports,
+//run being the default one
+var commands = map[string]command{
+	"run": {
+		usage:       "run",
+		description: "Keep every board synced up until stopped",
+		run:         run,
+	},
+	"sync": {
+		usage:       "sync --once [--board b]",
+		description: "Make a single pass over every board, or only b, and exit",
+		run:         syncOnce,
+	},
+	"status": {
+		usage:       "status",
+		description: "Show the cursor and lag of every index",
+		run:         status,
+	},
+	"reset": {
+		usage:       "reset <board> [--to timestamp] [--sink s]",
+		description: "Move the cursor of a board to an RFC 3339 timestamp, the very start by default",
+		run:         reset,
+	},
+	"create-index": {
+		usage:       "create-index <board>",
+		description: "Create the index and tracker of a board in every sink",
+		run:         createIndex,
+	},
+	"reindex": {
+		usage:       "reindex <board>",
+		description: "Request a rebuild of the index of a board in every sink",
+		run:         reindex,
+	},
+	"dead-letters": {
+		usage:       "dead-letters <board> [--retry|--discard] [--sink s]",
+		description: "List the posts of a board sinks rejected, or retry or discard them",
+		run:         deadLetters,
+	},
+	"verify": {
+		usage:       "verify <board> [--repair] [--sink s]",
+		description: "Compare the index of a board in every sink with the database",
+		run:         verify,
+	},
+}
+
 func main() {
-	log.Println("Starting Moon")
-	conf := config.LoadConfig()
+	name := "run"
+	args := os.Args[1:]
 
-	time.Sleep(5 * time.Second)
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
 
-	sqldb := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(conf.PostgresConfig.ConnectionString)))
-	pg := bun.NewDB(sqldb, pgdialect.New())
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
+	}
 
-	lnxService := lnx.NewService(conf.LnxConfig)
+	cmd, ok := commands[name]
 
-	napTime, err := time.ParseDuration(conf.LnxConfig.NapTime)
-	if err != nil {
-		napTime = 20 * time.Minute
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	conf := config.LoadConfig()
+
+	if err := setupLogging(conf.LogConfig); err != nil {
+		fatal(err.Error())
 	}
 
 	for _, board := range conf.Boards {
-		indexTracker := db.IndexTracker{
-			Board:        board.Name,
-			LastModified: time.UnixMicro(0),
-			PostNumber:   0,
+		if _, err := lnx.NewSchema(board.Schema); err != nil {
+			fatal("Invalid schema", "board", board.Name, "error", err)
 		}
 
 		if board.ForceRecreate {
-			_, err := pg.NewInsert().
-				Model(&indexTracker).
-				On("CONFLICT (board) DO UPDATE SET last_modified = EXCLUDED.last_modified, post_number = EXCLUDED.post_number").
-				Returning("NULL").
-				Exec(context.Background())
-
-			if err != nil {
-				log.Fatalf("Error creating index tracker for board %s", board.Name)
-			}
-		} else {
-			_, err := pg.NewInsert().
-				Model(&indexTracker).
-				On("CONFLICT DO NOTHING").
-				Returning("NULL").
-				Exec(context.Background())
-
-			if err != nil {
-				log.Fatalf("Error creating index tracker for board %s", board.Name)
-			}
+			fatal("force_recreate is no longer supported, run moon reindex instead", "board", board.Name)
 		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		lnxService.CreateIndex(board)
+	if err := cmd.run(ctx, conf, openDB(conf), args); err != nil {
+		fatal(err.Error())
 	}
+}
+
+//usage prints every subcommand
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: moon <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+
+	for _, name := range []string{"run", "sync", "status", "reset", "create-index", "reindex", "dead-letters", "verify"} {
+		fmt.Fprintf(os.Stderr, "  %-52s %s\n", commands[name].usage, commands[name].description)
+	}
+}
+
+//openDB returns a handle to the database, which
+//isn't connected to until it's first used
+func openDB(conf config.Config) *bun.DB {
+	sqldb := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(conf.PostgresConfig.ConnectionString)))
+	return bun.NewDB(sqldb, pgdialect.New())
+}
+
+//parseArgs parses flags wherever they are among the
+//arguments, returning the ones that aren't flags
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
 
 	for {
-		for _, board := range conf.Boards {
-			dbPosts := make([]db.Post, 0, conf.LnxConfig.BatchSize)
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
 
-			log.Printf("Indexing board %s\n", board.Name)
+		args = fs.Args()
 
-			maxTime := time.Now().Add(-5 * time.Second)
+		if len(args) == 0 {
+			return positional, nil
+		}
 
-			tx, err := pg.BeginTx(context.Background(), &sql.TxOptions{})
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
 
-			if err != nil {
-				panic(err)
-			}
+//boardConfig returns the configuration of a board
+func boardConfig(conf config.Config, board string) (config.BoardConfig, error) {
+	for _, b := range conf.Boards {
+		if b.Name == board {
+			return b, nil
+		}
+	}
 
-			indexTracker := db.IndexTracker{}
+	return config.BoardConfig{}, fmt.Errorf("Board %s is not configured", board)
+}
 
-			err = tx.NewSelect().
-				Model(&indexTracker).
-				Where("board = ?", board.Name).
-				Scan(context.Background())
+//sinkNames returns the names of the sinks selected in the configuration
+func sinkNames(conf config.Config) []string {
+	names := conf.SyncConfig.Sinks
 
-			if err != nil {
-				tx.Rollback()
-				panic(err)
-			}
+	if len(names) == 0 && conf.SyncConfig.Sink != "" {
+		names = []string{conf.SyncConfig.Sink}
+	}
 
-			if err := lnxService.Rollback(board.Name); err != nil {
-				tx.Rollback()
-				panic(err)
-			}
+	if len(names) == 0 {
+		names = []string{"lnx"}
+	}
 
-			previousScrape := indexTracker.LastModified
-
-			for {
-				dbPosts = dbPosts[0:0]
-
-				err := tx.NewSelect().
-					Model(&dbPosts).
-					Where("board = ?", board.Name).
-					Where("last_modified < ?", maxTime).
-					Where("(last_modified, post_number) > (?, ?)", indexTracker.LastModified, indexTracker.PostNumber).
-					Order("last_modified ASC", "post_number ASC").
-					Limit(conf.LnxConfig.BatchSize).
-					For("NO KEY UPDATE").
-					Scan(context.Background())
-
-				if err != nil {
-					tx.Rollback()
-					panic(err)
-				}
-
-				if len(dbPosts) == 0 {
-					break
-				}
-
-				lastPost := dbPosts[len(dbPosts)-1]
-				indexTracker.LastModified = lastPost.LastModified
-				indexTracker.PostNumber = lastPost.PostNumber
-
-				if err := lnxService.Upsert(dbPosts, board.Name, previousScrape); err != nil {
-					tx.Rollback()
-					panic(err)
-				}
-			}
+	return names
+}
 
-			if err := lnxService.Commit(board.Name); err != nil {
-				tx.Rollback()
-				panic(err)
-			}
+//newSinks constructs every sink selected in the configuration
+func newSinks(ctx context.Context, conf config.Config) ([]sink.Named, error) {
+	names := sinkNames(conf)
 
-			_, err = tx.NewUpdate().
-				Model(&indexTracker).
-				WherePK().
-				Returning("NULL").
-				Exec(context.Background())
+	sinks := make([]sink.Named, 0, len(names))
+	seen := make(map[string]bool, len(names))
 
-			if err != nil {
-				panic(err)
-			}
+	for _, name := range names {
+		if seen[name] {
+			return nil, fmt.Errorf("Sink %s is configured more than once", name)
+		}
 
-			if err := tx.Commit(); err != nil {
-				panic(err)
-			}
+		seen[name] = true
+
+		s, err := newSink(ctx, conf, name)
+
+		if err != nil {
+			return nil, err
 		}
 
-		log.Println("Napping")
-		time.Sleep(napTime)
+		sinks = append(sinks, sink.Named{Sink: s, Name: name})
+	}
+
+	return sinks, nil
+}
+
+//newSink constructs the sink with the name passed
+func newSink(ctx context.Context, conf config.Config, name string) (sink.Sink, error) {
+	switch name {
+	case "lnx":
+		lnxService := lnx.NewService(conf.LnxConfig)
+		return &lnxService, nil
+	case "meilisearch":
+		return meilisearch.NewService(conf.MeilisearchConfig), nil
+	case "elasticsearch", "opensearch":
+		return elasticsearch.NewService(conf.ElasticsearchConfig), nil
+	case "typesense":
+		return typesense.NewService(conf.TypesenseConfig), nil
+	case "bleve":
+		return bleve.NewService(conf.BleveConfig), nil
+	case "jsonl":
+		return jsonl.NewService(conf.JSONLConfig), nil
+	default:
+		return nil, fmt.Errorf("Unknown sink %s", name)
 	}
 }
+
+//closeSinks closes every sink that holds resources
+func closeSinks(sinks []sink.Named) error {
+	for _, s := range sinks {
+		if closer, ok := s.Sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				return fmt.Errorf("Error closing %s: %w", s.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
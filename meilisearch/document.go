@@ -0,0 +1,32 @@
+//Package meilisearch indexes posts into Meilisearch
+//by providing entities and a Service
+package meilisearch
+
+import (
+	"moon/db"
+	"moon/lnx"
+)
+
+//Document is a post as sent to Meilisearch. It has the same
+//fields as an lnx.Post except for time_posted, which is sent as
+//a unix timestamp so it can be filtered and sorted on.
+type Document struct {
+	lnx.Post
+	TimePosted int64 `json:"time_posted"`
+}
+
+//DbPostsToDocuments converts an array of db.Post into an
+//array of Document, leaving hidden posts out
+func DbPostsToDocuments(posts []db.Post) []Document {
+	lnxPosts := lnx.DbPostsToLnxPosts(posts)
+	result := make([]Document, 0, len(lnxPosts))
+
+	for _, p := range lnxPosts {
+		result = append(result, Document{
+			Post:       p,
+			TimePosted: p.TimePosted.Unix(),
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,296 @@
+package meilisearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"moon/config"
+	"moon/db"
+	"moon/lnx"
+	"moon/sink"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var _ sink.Sink = (*Service)(nil)
+var _ sink.Pinger = (*Service)(nil)
+
+//Service wraps writes and upserts to Meilisearch.
+//Meilisearch applies writes asynchronously, so the
+//tasks enqueued for every index are kept until Commit
+//confirms they have all been applied.
+type Service struct {
+	host   string
+	apiKey string
+	client http.Client
+
+	mutex   sync.Mutex
+	pending map[string][]int64
+}
+
+//NewService constructs and returns a Service
+func NewService(conf config.MeilisearchConfig) *Service {
+	return &Service{
+		host:   fmt.Sprintf("%s:%d", conf.Host, conf.Port),
+		apiKey: conf.APIKey,
+		client: http.Client{
+			Timeout: 30 * time.Second,
+		},
+		pending: make(map[string][]int64),
+	}
+}
+
+//Upsert upserts an array of posts into Meilisearch,
+//deleting hidden posts from the index
+func (s *Service) Upsert(ctx context.Context, posts []db.Post, index string, previousScrape time.Time) error {
+	hidden := make([]db.Post, 0, 10)
+
+	for _, p := range posts {
+		if p.Hidden {
+			hidden = append(hidden, p)
+		}
+	}
+
+	if err := s.Delete(ctx, hidden, index); err != nil {
+		return err
+	}
+
+	documents := DbPostsToDocuments(posts)
+
+	if len(documents) == 0 {
+		return nil
+	}
+
+	t, err := s.enqueue(ctx, "POST", fmt.Sprintf("/indexes/%s/documents?primaryKey=post_number", index), documents)
+
+	if err != nil {
+		return fmt.Errorf("Error inserting posts: %w", err)
+	}
+
+	s.track(index, t)
+
+	return nil
+}
+
+//Delete deletes an array of posts from Meilisearch
+func (s *Service) Delete(ctx context.Context, posts []db.Post, index string) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	postNumbers := make([]int64, 0, len(posts))
+
+	for _, p := range posts {
+		postNumbers = append(postNumbers, p.PostNumber)
+	}
+
+	t, err := s.enqueue(ctx, "POST", fmt.Sprintf("/indexes/%s/documents/delete-batch", index), postNumbers)
+
+	if err != nil {
+		return fmt.Errorf("Error deleting posts: %w", err)
+	}
+
+	s.track(index, t)
+
+	return nil
+}
+
+//Commit waits until every task enqueued for the index
+//since the last commit or rollback has been applied
+func (s *Service) Commit(ctx context.Context, index string) error {
+	s.mutex.Lock()
+	pending := s.pending[index]
+	delete(s.pending, index)
+	s.mutex.Unlock()
+
+	for _, taskUID := range pending {
+		if err := s.waitForTask(ctx, taskUID); err != nil {
+			return fmt.Errorf("Error committing index %s: %w", index, err)
+		}
+	}
+
+	return nil
+}
+
+//Rollback forgets about the tasks enqueued for the index.
+//Meilisearch can't undo them, but as documents are keyed by
+//post number reindexing the same posts afterwards is harmless.
+func (s *Service) Rollback(ctx context.Context, index string) error {
+	s.mutex.Lock()
+	delete(s.pending, index)
+	s.mutex.Unlock()
+
+	return nil
+}
+
+//CreateIndex creates an index for a board and configures
+//its searchable, filterable and sortable attributes
+func (s *Service) CreateIndex(ctx context.Context, index string, conf config.BoardConfig) error {
+	schema, err := lnx.NewSchema(conf.Schema)
+
+	if err != nil {
+		return fmt.Errorf("Error building schema for index %s: %w", index, err)
+	}
+
+	t, err := s.enqueue(ctx, "POST", "/indexes", map[string]string{
+		"uid":        index,
+		"primaryKey": "post_number",
+	})
+
+	if err != nil {
+		return fmt.Errorf("Error creating index %s: %w", index, err)
+	}
+
+	if err := s.waitForTask(ctx, t.TaskUID); err != nil {
+		if !hasCode(err, "index_already_exists") {
+			return fmt.Errorf("Error creating index %s: %w", index, err)
+		}
+
+		slog.Info("Index already exists", "sink", "meilisearch", "index", index)
+	}
+
+	t, err = s.enqueue(ctx, "PATCH", fmt.Sprintf("/indexes/%s/settings", index), buildSettings(schema))
+
+	if err != nil {
+		return fmt.Errorf("Error updating settings for index %s: %w", index, err)
+	}
+
+	if err := s.waitForTask(ctx, t.TaskUID); err != nil {
+		return fmt.Errorf("Error updating settings for index %s: %w", index, err)
+	}
+
+	return nil
+}
+
+//DropIndex deletes an index
+func (s *Service) DropIndex(ctx context.Context, index string) error {
+	t, err := s.enqueue(ctx, "DELETE", fmt.Sprintf("/indexes/%s", index), nil)
+
+	if err != nil {
+		return fmt.Errorf("Error deleting index %s: %w", index, err)
+	}
+
+	if err := s.waitForTask(ctx, t.TaskUID); err != nil && !hasCode(err, "index_not_found") {
+		return fmt.Errorf("Error deleting index %s: %w", index, err)
+	}
+
+	return nil
+}
+
+//Count returns the number of posts in an index
+func (s *Service) Count(ctx context.Context, index string) (int64, error) {
+	var stats struct {
+		NumberOfDocuments int64 `json:"numberOfDocuments"`
+	}
+
+	if err := s.do(ctx, "GET", fmt.Sprintf("/indexes/%s/stats", index), nil, &stats); err != nil {
+		return 0, fmt.Errorf("Error counting posts in index %s: %w", index, err)
+	}
+
+	return stats.NumberOfDocuments, nil
+}
+
+func (s *Service) track(index string, t task) {
+	s.mutex.Lock()
+	s.pending[index] = append(s.pending[index], t.TaskUID)
+	s.mutex.Unlock()
+}
+
+//enqueue performs a request Meilisearch answers
+//with a summary of the task it enqueued
+func (s *Service) enqueue(ctx context.Context, method string, path string, body interface{}) (task, error) {
+	var t task
+
+	if err := s.do(ctx, method, path, body, &t); err != nil {
+		return t, err
+	}
+
+	return t, nil
+}
+
+//waitForTask polls a task until Meilisearch is done with it,
+//returning an error if it didn't succeed
+func (s *Service) waitForTask(ctx context.Context, taskUID int64) error {
+	for {
+		var t task
+
+		if err := s.do(ctx, "GET", fmt.Sprintf("/tasks/%d", taskUID), nil, &t); err != nil {
+			return err
+		}
+
+		switch t.Status {
+		case "succeeded":
+			return nil
+		case "failed":
+			if t.Error == nil {
+				return &TaskError{TaskUID: taskUID, Code: "unknown", Message: "task failed"}
+			}
+
+			return &TaskError{TaskUID: taskUID, Code: t.Error.Code, Message: t.Error.Message}
+		case "canceled":
+			return &TaskError{TaskUID: taskUID, Code: "canceled", Message: "task was canceled"}
+		}
+
+		timer := time.NewTimer(500 * time.Millisecond)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+//Ping checks Meilisearch is available
+func (s *Service) Ping(ctx context.Context) error {
+	var health struct {
+		Status string `json:"status"`
+	}
+
+	if err := s.do(ctx, "GET", "/health", nil, &health); err != nil {
+		return fmt.Errorf("Error reaching Meilisearch: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Service) do(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+
+	if body != nil {
+		b, err := json.Marshal(body)
+
+		if err != nil {
+			return err
+		}
+
+		reader = bytes.NewReader(b)
+	}
+
+	r, _ := http.NewRequestWithContext(ctx, method, s.host+path, reader)
+	r.Header.Set("Content-Type", "application/json")
+
+	if s.apiKey != "" {
+		r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.apiKey))
+	}
+
+	resp, err := s.client.Do(r)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("Request received status %s: %s", resp.Status, b)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
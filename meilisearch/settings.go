@@ -0,0 +1,40 @@
+package meilisearch
+
+import (
+	"moon/lnx"
+	"sort"
+)
+
+//settings are the index settings Moon configures, mirroring
+//the fields Lnx searches, filters and sorts on
+type settings struct {
+	SearchableAttributes []string `json:"searchableAttributes"`
+	FilterableAttributes []string `json:"filterableAttributes"`
+	SortableAttributes   []string `json:"sortableAttributes"`
+}
+
+//buildSettings builds the settings of an index from the
+//schema of a board. Indexed fields other than text are
+//filterable, while fast and date fields are sortable.
+func buildSettings(schema lnx.Schema) settings {
+	s := settings{
+		SearchableAttributes: schema.SearchFields,
+		FilterableAttributes: make([]string, 0, len(schema.Fields)),
+		SortableAttributes:   make([]string, 0, len(schema.Fields)),
+	}
+
+	for name, field := range schema.Fields {
+		if field.Indexed && field.Type != "text" {
+			s.FilterableAttributes = append(s.FilterableAttributes, name)
+		}
+
+		if field.Fast || field.Type == "date" {
+			s.SortableAttributes = append(s.SortableAttributes, name)
+		}
+	}
+
+	sort.Strings(s.FilterableAttributes)
+	sort.Strings(s.SortableAttributes)
+
+	return s
+}
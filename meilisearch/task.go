@@ -0,0 +1,37 @@
+package meilisearch
+
+import (
+	"errors"
+	"fmt"
+)
+
+//task is an asynchronous Meilisearch operation
+type task struct {
+	TaskUID int64      `json:"taskUid"`
+	UID     int64      `json:"uid"`
+	Status  string     `json:"status"`
+	Error   *taskError `json:"error"`
+}
+
+//taskError describes why a task failed
+type taskError struct {
+	Message string `json:"message"`
+	Code    string `json:"code"`
+}
+
+//TaskError is returned when a Meilisearch task fails
+type TaskError struct {
+	TaskUID int64
+	Code    string
+	Message string
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("Task %d failed with code %s: %s", e.TaskUID, e.Code, e.Message)
+}
+
+func hasCode(err error, code string) bool {
+	var taskError *TaskError
+
+	return errors.As(err, &taskError) && taskError.Code == code
+}
@@ -0,0 +1,145 @@
+//Package metrics holds the Prometheus metrics Moon exposes
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	//PostsUpserted counts the posts upserted into every sink
+	PostsUpserted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "moon_posts_upserted_total",
+		Help: "Posts upserted, by sink and board",
+	}, []string{"sink", "board"})
+
+	//PostsDeleted counts the hidden posts deleted from every sink
+	PostsDeleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "moon_posts_deleted_total",
+		Help: "Hidden posts deleted, by sink and board",
+	}, []string{"sink", "board"})
+
+	//DeadLetters counts the posts set aside as sinks rejected them
+	DeadLetters = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "moon_dead_letters_total",
+		Help: "Posts rejected by sinks and set aside, by sink and board",
+	}, []string{"sink", "board"})
+
+	//BatchDuration observes how long batches take, from
+	//querying the posts to indexing them, counting them too
+	BatchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "moon_batch_duration_seconds",
+		Help:    "Duration of batches, by sink and board",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"sink", "board"})
+
+	//PassDuration is how long the last successful pass took
+	PassDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "moon_last_pass_duration_seconds",
+		Help: "Duration of the last successful pass, by sink, board and index",
+	}, []string{"sink", "board", "index"})
+
+	//LnxRequestDuration observes Lnx request latency
+	LnxRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "moon_lnx_request_duration_seconds",
+		Help:    "Latency of Lnx requests, by endpoint",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	//LnxRequests counts Lnx requests by status code,
+	//or "error" if no response was received
+	LnxRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "moon_lnx_requests_total",
+		Help: "Lnx requests, by endpoint and status code",
+	}, []string{"endpoint", "status"})
+
+	//LnxRetries counts retried Lnx requests
+	LnxRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "moon_lnx_retries_total",
+		Help: "Retried Lnx requests, by endpoint",
+	}, []string{"endpoint"})
+)
+
+var trackerLabels = []string{"sink", "board", "index"}
+
+//trackerKey identifies an index tracker
+type trackerKey struct {
+	sink  string
+	board string
+	index string
+}
+
+//trackerCollector exposes the cursor of every index tracker,
+//computing the lag when scraped so it keeps growing while a
+//board isn't being synced
+type trackerCollector struct {
+	mutex    sync.Mutex
+	trackers map[trackerKey]time.Time
+
+	lastModified *prometheus.Desc
+	lag          *prometheus.Desc
+}
+
+var trackers = &trackerCollector{
+	trackers: make(map[trackerKey]time.Time),
+	lastModified: prometheus.NewDesc(
+		"moon_tracker_last_modified_seconds",
+		"Unix time of the last_modified cursor, by sink, board and index",
+		trackerLabels, nil,
+	),
+	lag: prometheus.NewDesc(
+		"moon_tracker_lag_seconds",
+		"Seconds the last_modified cursor is behind now, by sink, board and index",
+		trackerLabels, nil,
+	),
+}
+
+func init() {
+	prometheus.MustRegister(trackers)
+}
+
+//Describe implements prometheus.Collector
+func (c *trackerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.lastModified
+	ch <- c.lag
+}
+
+//Collect implements prometheus.Collector
+func (c *trackerCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+
+	for key, lastModified := range c.trackers {
+		ch <- prometheus.MustNewConstMetric(c.lastModified, prometheus.GaugeValue, float64(lastModified.UnixMicro())/1e6, key.sink, key.board, key.index)
+		ch <- prometheus.MustNewConstMetric(c.lag, prometheus.GaugeValue, now.Sub(lastModified).Seconds(), key.sink, key.board, key.index)
+	}
+}
+
+//SetTracker records the cursor of an index tracker
+func SetTracker(sink string, board string, index string, lastModified time.Time) {
+	trackers.mutex.Lock()
+	trackers.trackers[trackerKey{sink, board, index}] = lastModified
+	trackers.mutex.Unlock()
+}
+
+//ForgetTracker stops exposing an index tracker
+//along with the duration of its last pass
+func ForgetTracker(sink string, board string, index string) {
+	trackers.mutex.Lock()
+	delete(trackers.trackers, trackerKey{sink, board, index})
+	trackers.mutex.Unlock()
+
+	PassDuration.DeleteLabelValues(sink, board, index)
+}
+
+//Handler serves every metric in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
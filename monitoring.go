@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"moon/indexer"
+	"moon/metrics"
+	"moon/sink"
+	"net/http"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+//serveMonitoring serves the endpoints monitoring systems
+//and container orchestrators scrape on address until ctx
+//is cancelled
+//
+//	/metrics  Prometheus metrics
+//	/healthz  200 unless a pass is stuck for longer than watchdogTimeout
+//	/readyz   200 once Postgres and the index of every board can be reached
+func serveMonitoring(ctx context.Context, address string, ix *indexer.Indexer, watchdogTimeout time.Duration) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := ix.Healthy(watchdogTimeout); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("ok\n"))
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		readyCtx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		if err := ix.Ready(readyCtx); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("ok\n"))
+	})
+
+	server := http.Server{
+		Addr:    address,
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Serving metrics and health checks", "address", address)
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+//waitForDependencies waits for Postgres and the servers
+//of every sink to be reachable, giving up after timeout
+func waitForDependencies(ctx context.Context, pg *bun.DB, sinks []sink.Named, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		err := checkDependencies(ctx, pg, sinks)
+
+		if err == nil {
+			return nil
+		}
+
+		slog.Info("Waiting for dependencies", "error", err)
+
+		timer := time.NewTimer(2 * time.Second)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("Dependencies not reachable after %s: %w", timeout, err)
+		}
+	}
+}
+
+func checkDependencies(ctx context.Context, pg *bun.DB, sinks []sink.Named) error {
+	if err := pg.PingContext(ctx); err != nil {
+		return fmt.Errorf("Error reaching Postgres: %w", err)
+	}
+
+	for _, s := range sinks {
+		if pinger, ok := s.Sink.(sink.Pinger); ok {
+			if err := pinger.Ping(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"moon/config"
+	"moon/db"
+	"moon/indexer"
+
+	"github.com/uptrace/bun"
+)
+
+//reindex requests a rebuild of the index of a board in every
+//sink, waking up a running Moon through the listen channel so
+//it's picked up right away rather than after the next nap
+func reindex(ctx context.Context, conf config.Config, pg *bun.DB, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Usage: moon reindex <board>")
+	}
+
+	boardConf, err := boardConfig(conf, args[0])
+
+	if err != nil {
+		return err
+	}
+
+	board := boardConf.Name
+
+	if err := db.Migrate(ctx, pg); err != nil {
+		return err
+	}
+
+	if err := indexer.RequestReindex(ctx, pg, board, sinkNames(conf)); err != nil {
+		return fmt.Errorf("Error requesting reindex of board %s: %w", board, err)
+	}
+
+	if conf.SyncConfig.ListenChannel != "" {
+		if _, err := pg.ExecContext(ctx, "SELECT pg_notify(?, ?)", conf.SyncConfig.ListenChannel, board); err != nil {
+			slog.Warn("Error notifying channel", "channel", conf.SyncConfig.ListenChannel, "error", err)
+		}
+	}
+
+	slog.Info("Requested reindex", "board", board)
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"moon/config"
+	"moon/db"
+	"moon/indexer"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+//reset moves the cursor of a board back so posts modified
+//since get reindexed. Passes in progress write their own
+//cursor back when they checkpoint, so Moon is best stopped
+//beforehand.
+func reset(ctx context.Context, conf config.Config, pg *bun.DB, args []string) error {
+	fs := flag.NewFlagSet("reset", flag.ContinueOnError)
+	to := fs.String("to", "", "RFC 3339 timestamp to move the cursor to")
+	sinkName := fs.String("sink", "", "Only reset the cursor of this sink")
+
+	positional, err := parseArgs(fs, args)
+
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 1 {
+		return fmt.Errorf("Usage: moon reset <board> [--to timestamp] [--sink s]")
+	}
+
+	boardConf, err := boardConfig(conf, positional[0])
+
+	if err != nil {
+		return err
+	}
+
+	cursor := time.UnixMicro(0)
+
+	if *to != "" {
+		if cursor, err = time.Parse(time.RFC3339, *to); err != nil {
+			return fmt.Errorf("Error parsing timestamp %s: %w", *to, err)
+		}
+	}
+
+	sinks := sinkNames(conf)
+
+	if *sinkName != "" {
+		sinks = []string{*sinkName}
+	}
+
+	if err := db.Migrate(ctx, pg); err != nil {
+		return err
+	}
+
+	n, err := indexer.Reset(ctx, pg, boardConf.Name, sinks, cursor)
+
+	if err != nil {
+		return fmt.Errorf("Error resetting board %s: %w", boardConf.Name, err)
+	}
+
+	slog.Info("Reset cursors", "board", boardConf.Name, "cursors", n, "to", cursor)
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"moon/admin"
+	"moon/bleve"
+	"moon/config"
+	"moon/db"
+	"moon/indexer"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+//run keeps every board synced up until ctx is cancelled
+func run(ctx context.Context, conf config.Config, pg *bun.DB, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("Usage: moon run")
+	}
+
+	slog.Info("Starting Moon")
+
+	sinks, err := newSinks(ctx, conf)
+
+	if err != nil {
+		return err
+	}
+
+	moonIndexer := indexer.NewIndexer(conf, pg, sinks)
+
+	if conf.MonitoringConfig.Address != "" {
+		watchdogTimeout, err := time.ParseDuration(conf.MonitoringConfig.WatchdogTimeout)
+		if err != nil {
+			watchdogTimeout = 30 * time.Minute
+		}
+
+		go func() {
+			if err := serveMonitoring(ctx, conf.MonitoringConfig.Address, moonIndexer, watchdogTimeout); err != nil {
+				slog.Error("Error serving metrics", "error", err)
+			}
+		}()
+	}
+
+	startupTimeout, err := time.ParseDuration(conf.SyncConfig.StartupTimeout)
+	if err != nil {
+		startupTimeout = 2 * time.Minute
+	}
+
+	if err := waitForDependencies(ctx, pg, sinks, startupTimeout); err != nil {
+		return err
+	}
+
+	if err := db.Migrate(ctx, pg); err != nil {
+		return err
+	}
+
+	for _, s := range sinks {
+		if bleveService, ok := s.Sink.(*bleve.Service); ok && conf.BleveConfig.SearchAddress != "" {
+			go func() {
+				if err := bleveService.Serve(ctx, conf.BleveConfig.SearchAddress); err != nil {
+					slog.Error("Error serving searches", "error", err)
+				}
+			}()
+		}
+	}
+
+	if err := moonIndexer.Setup(ctx); err != nil {
+		return err
+	}
+
+	if conf.AdminConfig.Address != "" {
+		if conf.AdminConfig.Token == "" {
+			return fmt.Errorf("A token is required to serve the admin API")
+		}
+
+		adminServer := admin.NewServer(conf.AdminConfig, moonIndexer, pg)
+
+		go func() {
+			if err := adminServer.Serve(ctx); err != nil {
+				slog.Error("Error serving the admin API", "error", err)
+			}
+		}()
+	}
+
+	if err := moonIndexer.Run(ctx); err != nil {
+		return err
+	}
+
+	if err := closeSinks(sinks); err != nil {
+		return err
+	}
+
+	slog.Info("Moon stopped")
+
+	return nil
+}
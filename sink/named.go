@@ -0,0 +1,8 @@
+package sink
+
+//Named is a sink along with the name it's configured
+//under, which its index tracker rows are keyed by
+type Named struct {
+	Sink
+	Name string
+}
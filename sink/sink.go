@@ -0,0 +1,86 @@
+//Package sink defines the interface search backends
+//implement so Moon can keep them synced up with the db
+package sink
+
+import (
+	"context"
+	"errors"
+	"moon/config"
+	"moon/db"
+	"time"
+)
+
+//ErrUnsupported is returned by sinks that can't
+//perform an operation at all
+var ErrUnsupported = errors.New("Operation not supported by sink")
+
+//ErrRejected is wrapped by errors of sinks refusing
+//to store posts, as opposed to failing to reach them,
+//so the posts responsible can be set aside
+var ErrRejected = errors.New("Posts rejected by sink")
+
+//Sink is a search backend posts get indexed into. Every
+//board is indexed into an index of its own, and a board
+//can have more than one index while it's being rebuilt.
+type Sink interface {
+	//CreateIndex creates an index for a board
+	//unless it already exists
+	CreateIndex(ctx context.Context, index string, conf config.BoardConfig) error
+
+	//DropIndex deletes an index
+	DropIndex(ctx context.Context, index string) error
+
+	//Count returns the number of posts in an index
+	Count(ctx context.Context, index string) (int64, error)
+
+	//Upsert indexes posts, replacing any previous version of
+	//them. Only posts created before previousScrape can already
+	//be in the index. Hidden posts are removed instead.
+	Upsert(ctx context.Context, posts []db.Post, index string, previousScrape time.Time) error
+
+	//Delete removes posts from the index
+	Delete(ctx context.Context, posts []db.Post, index string) error
+
+	//Commit makes every modification since the last
+	//commit or rollback visible
+	Commit(ctx context.Context, index string) error
+
+	//Rollback discards every modification since the
+	//last commit or rollback
+	Rollback(ctx context.Context, index string) error
+}
+
+//Pinger is implemented by sinks that depend on a
+//server Moon has to wait for on startup
+type Pinger interface {
+	//Ping checks the server can be reached
+	Ping(ctx context.Context) error
+}
+
+//Prober is implemented by sinks that can check an index
+//exists more cheaply than by counting its posts
+type Prober interface {
+	//Probe returns an error unless the index can be reached
+	Probe(ctx context.Context, index string) error
+}
+
+//Schemaless is implemented by sinks that store posts the
+//same way whatever the schema of the board, so changing the
+//schema never calls for a rebuild
+type Schemaless interface {
+	//Schemaless reports whether the schema is ignored
+	Schemaless() bool
+}
+
+//Verifier is implemented by sinks that can look up the
+//posts of an index by post number, so its contents can
+//be checked against the database
+type Verifier interface {
+	//CountRange returns the number of posts in an index
+	//numbered from from to to, both included
+	CountRange(ctx context.Context, index string, from int64, to int64) (int64, error)
+
+	//PostNumbers returns the number of every post in an index
+	//numbered from from to to, both included, once per copy
+	PostNumbers(ctx context.Context, index string, from int64, to int64) ([]int64, error)
+}
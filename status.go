@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"moon/config"
+	"moon/db"
+	"moon/indexer"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+//status prints the cursor and lag of every index
+func status(ctx context.Context, conf config.Config, pg *bun.DB, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("Usage: moon status")
+	}
+
+	if err := db.Migrate(ctx, pg); err != nil {
+		return err
+	}
+
+	statuses, err := indexer.Status(ctx, pg)
+
+	if err != nil {
+		return fmt.Errorf("Error reading status: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "BOARD\tSINK\tINDEX\tLAST MODIFIED\tPOST NUMBER\tPENDING\tLAG")
+
+	for _, s := range statuses {
+		index := s.IndexName
+
+		if !s.Live {
+			index += " (rebuilding)"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\n", s.Board, s.Sink, index, s.LastModified.Format(time.RFC3339), s.PostNumber, s.Pending, s.Lag.Round(time.Second))
+	}
+
+	return w.Flush()
+}
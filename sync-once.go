@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"moon/config"
+	"moon/db"
+	"moon/indexer"
+
+	"github.com/uptrace/bun"
+)
+
+//syncOnce makes a single pass over every board,
+//or only the one passed, and returns
+func syncOnce(ctx context.Context, conf config.Config, pg *bun.DB, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	once := fs.Bool("once", false, "Make a single pass and exit")
+	board := fs.String("board", "", "Only sync this board")
+
+	positional, err := parseArgs(fs, args)
+
+	if err != nil {
+		return err
+	}
+
+	if !*once || len(positional) != 0 {
+		return fmt.Errorf("Usage: moon sync --once [--board b]")
+	}
+
+	if *board != "" {
+		boardConf, err := boardConfig(conf, *board)
+
+		if err != nil {
+			return err
+		}
+
+		conf.Boards = []config.BoardConfig{boardConf}
+	}
+
+	if err := db.Migrate(ctx, pg); err != nil {
+		return err
+	}
+
+	sinks, err := newSinks(ctx, conf)
+
+	if err != nil {
+		return err
+	}
+
+	moonIndexer := indexer.NewIndexer(conf, pg, sinks)
+
+	err = moonIndexer.Prepare(ctx)
+
+	if err == nil {
+		err = moonIndexer.SyncOnce(ctx, *board)
+	}
+
+	if closeErr := closeSinks(sinks); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,51 @@
+package typesense
+
+import "moon/lnx"
+
+//collection is the schema of a Typesense collection
+type collection struct {
+	Name   string  `json:"name"`
+	Fields []field `json:"fields"`
+}
+
+type field struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Facet    bool   `json:"facet"`
+	Optional bool   `json:"optional"`
+	Index    bool   `json:"index"`
+	Sort     bool   `json:"sort,omitempty"`
+}
+
+//fieldTypes maps Lnx field types to Typesense ones. Dates
+//are stored as unix timestamps.
+var fieldTypes = map[string]string{
+	"i64":    "int64",
+	"f64":    "float",
+	"date":   "int64",
+	"text":   "string",
+	"string": "string",
+}
+
+//buildCollection builds a collection schema from the fields
+//of an Lnx index. Lnx string fields are only matched exactly,
+//so they're made facets, while fast fields can be sorted on.
+func buildCollection(name string, fields map[string]lnx.IndexField) collection {
+	c := collection{
+		Name:   name,
+		Fields: make([]field, 0, len(fields)),
+	}
+
+	for fieldName, f := range fields {
+		c.Fields = append(c.Fields, field{
+			Name:     fieldName,
+			Type:     fieldTypes[f.Type],
+			Facet:    f.Type == "string",
+			Optional: !f.Required,
+			Index:    f.Indexed,
+			Sort:     f.Fast,
+		})
+	}
+
+	return c
+}
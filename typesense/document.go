@@ -0,0 +1,36 @@
+//Package typesense indexes posts into Typesense
+//by providing entities and a Service
+package typesense
+
+import (
+	"moon/db"
+	"moon/lnx"
+	"strconv"
+)
+
+//Document is a post as imported into Typesense. It has the
+//same fields as an lnx.Post plus the id Typesense requires,
+//with time_posted sent as a unix timestamp as Typesense has
+//no date type.
+type Document struct {
+	ID string `json:"id"`
+	lnx.Post
+	TimePosted int64 `json:"time_posted"`
+}
+
+//DbPostsToDocuments converts an array of db.Post into an
+//array of Document, leaving hidden posts out
+func DbPostsToDocuments(posts []db.Post) []Document {
+	lnxPosts := lnx.DbPostsToLnxPosts(posts)
+	result := make([]Document, 0, len(lnxPosts))
+
+	for _, p := range lnxPosts {
+		result = append(result, Document{
+			ID:         strconv.FormatInt(p.PostNumber, 10),
+			Post:       p,
+			TimePosted: p.TimePosted.Unix(),
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,26 @@
+package typesense
+
+import (
+	"fmt"
+	"strings"
+)
+
+//importResult is the result for a single
+//line of a JSONL import request
+type importResult struct {
+	Success  bool   `json:"success"`
+	Error    string `json:"error"`
+	Document string `json:"document"`
+}
+
+//ImportError is returned when some of the documents
+//in an import couldn't be imported
+type ImportError struct {
+	Failed  int
+	Total   int
+	Reasons []string
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("%d out of %d documents failed to import: %s", e.Failed, e.Total, strings.Join(e.Reasons, "; "))
+}
@@ -0,0 +1,318 @@
+package typesense
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"moon/config"
+	"moon/db"
+	"moon/lnx"
+	"moon/sink"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var _ sink.Sink = (*Service)(nil)
+var _ sink.Pinger = (*Service)(nil)
+
+//Service wraps writes and upserts to Typesense
+type Service struct {
+	host   string
+	apiKey string
+	client http.Client
+}
+
+//NewService constructs and returns a Service
+func NewService(conf config.TypesenseConfig) *Service {
+	return &Service{
+		host:   fmt.Sprintf("%s:%d", conf.Host, conf.Port),
+		apiKey: conf.APIKey,
+		client: http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+//Upsert imports an array of posts into Typesense, deleting
+//hidden posts. Documents that fail to import are retried a
+//couple of times before the whole batch is reported as failed.
+func (s *Service) Upsert(ctx context.Context, posts []db.Post, collection string, previousScrape time.Time) error {
+	hidden := make([]db.Post, 0, 10)
+
+	for _, p := range posts {
+		if p.Hidden {
+			hidden = append(hidden, p)
+		}
+	}
+
+	if err := s.Delete(ctx, hidden, collection); err != nil {
+		return err
+	}
+
+	documents := DbPostsToDocuments(posts)
+
+	for i := 0; len(documents) > 0; i++ {
+		failed, err := s.importDocuments(ctx, documents, collection)
+
+		if err != nil {
+			return fmt.Errorf("Error importing posts: %w", err)
+		}
+
+		if len(failed.indexes) == 0 {
+			return nil
+		}
+
+		if i >= 2 {
+			return fmt.Errorf("Error importing posts: %w: %w", sink.ErrRejected, failed.err)
+		}
+
+		slog.Warn("Retrying documents that failed to import", "sink", "typesense", "index", collection, "documents", len(failed.indexes), "error", failed.err)
+
+		retries := make([]Document, 0, len(failed.indexes))
+
+		for _, index := range failed.indexes {
+			retries = append(retries, documents[index])
+		}
+
+		documents = retries
+
+		timer := time.NewTimer(time.Duration(i+1) * time.Second)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+//Delete deletes an array of posts from Typesense
+func (s *Service) Delete(ctx context.Context, posts []db.Post, collection string) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(posts))
+
+	for _, p := range posts {
+		ids = append(ids, fmt.Sprint(p.PostNumber))
+	}
+
+	query := url.Values{}
+	query.Set("filter_by", fmt.Sprintf("id:[%s]", strings.Join(ids, ",")))
+	query.Set("batch_size", fmt.Sprint(len(ids)))
+
+	resp, err := s.do(ctx, "DELETE", fmt.Sprintf("/collections/%s/documents?%s", collection, query.Encode()), "", nil)
+
+	if err != nil {
+		return fmt.Errorf("Error deleting posts: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Error deleting posts: %w", statusError(resp))
+	}
+
+	return nil
+}
+
+//Commit is a no-op, as Typesense makes
+//imported documents searchable right away
+func (s *Service) Commit(ctx context.Context, collection string) error {
+	return nil
+}
+
+//Rollback is a no-op, as Typesense can't undo imports. The
+//upsert import action lets a retried pass overwrite them.
+func (s *Service) Rollback(ctx context.Context, collection string) error {
+	return nil
+}
+
+//CreateIndex creates a collection for a board from
+//the same fields the Lnx index is created with
+func (s *Service) CreateIndex(ctx context.Context, collection string, conf config.BoardConfig) error {
+	schema, err := lnx.NewSchema(conf.Schema)
+
+	if err != nil {
+		return fmt.Errorf("Error building schema for collection %s: %w", collection, err)
+	}
+
+	b, err := json.Marshal(buildCollection(collection, schema.Fields))
+
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, "POST", "/collections", "application/json", bytes.NewReader(b))
+
+	if err != nil {
+		return fmt.Errorf("Error creating collection %s: %w", collection, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 409 {
+		slog.Info("Collection already exists", "sink", "typesense", "index", collection)
+		return nil
+	}
+
+	if resp.StatusCode != 201 {
+		return fmt.Errorf("Error creating collection %s: %w", collection, statusError(resp))
+	}
+
+	return nil
+}
+
+//DropIndex deletes a collection
+func (s *Service) DropIndex(ctx context.Context, collection string) error {
+	resp, err := s.do(ctx, "DELETE", "/collections/"+collection, "", nil)
+
+	if err != nil {
+		return fmt.Errorf("Error deleting collection %s: %w", collection, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && resp.StatusCode != 404 {
+		return fmt.Errorf("Error deleting collection %s: %w", collection, statusError(resp))
+	}
+
+	return nil
+}
+
+//Count returns the number of posts in a collection
+func (s *Service) Count(ctx context.Context, collection string) (int64, error) {
+	resp, err := s.do(ctx, "GET", "/collections/"+collection, "", nil)
+
+	if err != nil {
+		return 0, fmt.Errorf("Error counting posts in collection %s: %w", collection, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return 0, fmt.Errorf("Error counting posts in collection %s: %w", collection, statusError(resp))
+	}
+
+	var collectionResponse struct {
+		NumDocuments int64 `json:"num_documents"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&collectionResponse); err != nil {
+		return 0, err
+	}
+
+	return collectionResponse.NumDocuments, nil
+}
+
+//importFailures holds the positions of the documents
+//that failed to import along with the reasons why
+type importFailures struct {
+	indexes []int
+	err     *ImportError
+}
+
+//importDocuments upserts documents through the JSONL import
+//endpoint, checking the result Typesense returns for every line
+func (s *Service) importDocuments(ctx context.Context, documents []Document, collection string) (importFailures, error) {
+	var b bytes.Buffer
+
+	encoder := json.NewEncoder(&b)
+
+	for i := range documents {
+		if err := encoder.Encode(&documents[i]); err != nil {
+			return importFailures{}, err
+		}
+	}
+
+	resp, err := s.do(ctx, "POST", fmt.Sprintf("/collections/%s/documents/import?action=upsert", collection), "text/plain", &b)
+
+	if err != nil {
+		return importFailures{}, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return importFailures{}, statusError(resp)
+	}
+
+	failures := importFailures{err: &ImportError{Total: len(documents)}}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	line := 0
+
+	for ; scanner.Scan(); line++ {
+		var result importResult
+
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return importFailures{}, fmt.Errorf("Error parsing import result: %w", err)
+		}
+
+		if result.Success {
+			continue
+		}
+
+		failures.indexes = append(failures.indexes, line)
+		failures.err.Failed++
+
+		if len(failures.err.Reasons) < 5 && line < len(documents) {
+			failures.err.Reasons = append(failures.err.Reasons, fmt.Sprintf("%s: %s", documents[line].ID, result.Error))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return importFailures{}, err
+	}
+
+	if line != len(documents) {
+		return importFailures{}, fmt.Errorf("Received %d import results for %d documents", line, len(documents))
+	}
+
+	return failures, nil
+}
+
+//Ping checks Typesense is available
+func (s *Service) Ping(ctx context.Context) error {
+	resp, err := s.do(ctx, "GET", "/health", "", nil)
+
+	if err != nil {
+		return fmt.Errorf("Error reaching Typesense: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Error reaching Typesense: %w", statusError(resp))
+	}
+
+	return nil
+}
+
+func (s *Service) do(ctx context.Context, method string, path string, contentType string, body io.Reader) (*http.Response, error) {
+	r, _ := http.NewRequestWithContext(ctx, method, s.host+path, body)
+
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	r.Header.Set("X-TYPESENSE-API-KEY", s.apiKey)
+
+	return s.client.Do(r)
+}
+
+func statusError(resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("Request received status %s: %s", resp.Status, b)
+}
@@ -0,0 +1,155 @@
+package typesense
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"moon/db"
+	"moon/sink"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//importServer is a stand-in Typesense that fails to import
+//the documents its reject function picks, and records the
+//ids every import request was sent
+type importServer struct {
+	reject func(id string, attempt int) bool
+
+	mutex   sync.Mutex
+	imports [][]string
+}
+
+func (is *importServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/collections/post_a/documents/import" || r.URL.Query().Get("action") != "upsert" {
+		http.NotFound(w, r)
+		return
+	}
+
+	is.mutex.Lock()
+	attempt := len(is.imports)
+	is.imports = append(is.imports, nil)
+	is.mutex.Unlock()
+
+	scanner := bufio.NewScanner(r.Body)
+
+	for scanner.Scan() {
+		var document Document
+
+		if err := json.Unmarshal(scanner.Bytes(), &document); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		is.mutex.Lock()
+		is.imports[attempt] = append(is.imports[attempt], document.ID)
+		is.mutex.Unlock()
+
+		if is.reject(document.ID, attempt) {
+			fmt.Fprintf(w, `{"success": false, "error": "Field comment must be a string", "document": %q}`+"\n", scanner.Text())
+		} else {
+			fmt.Fprintln(w, `{"success": true}`)
+		}
+	}
+}
+
+func newImportServer(t *testing.T, reject func(id string, attempt int) bool) (*Service, *importServer) {
+	is := &importServer{reject: reject}
+	srv := httptest.NewServer(is)
+
+	t.Cleanup(srv.Close)
+
+	return &Service{host: srv.URL, client: http.Client{Timeout: 5 * time.Second}}, is
+}
+
+func testPosts(postNumbers ...int64) []db.Post {
+	posts := make([]db.Post, 0, len(postNumbers))
+
+	for _, postNumber := range postNumbers {
+		posts = append(posts, db.Post{Board: "a", PostNumber: postNumber, TimePosted: time.Unix(postNumber, 0)})
+	}
+
+	return posts
+}
+
+func TestImportDocuments(t *testing.T) {
+	s, _ := newImportServer(t, func(id string, attempt int) bool {
+		return id == "2" || id == "4"
+	})
+
+	failures, err := s.importDocuments(context.Background(), DbPostsToDocuments(testPosts(1, 2, 3, 4)), "post_a")
+
+	if err != nil {
+		t.Fatalf("importDocuments() failed: %s", err)
+	}
+
+	if fmt.Sprint(failures.indexes) != "[1 3]" {
+		t.Errorf("Failed indexes = %v, want [1 3]", failures.indexes)
+	}
+
+	if failures.err.Failed != 2 || failures.err.Total != 4 || len(failures.err.Reasons) != 2 {
+		t.Errorf("Import error = %+v, want 2 out of 4 failed", failures.err)
+	}
+
+	if !strings.HasPrefix(failures.err.Reasons[0], "2: Field comment must be a string") {
+		t.Errorf("First reason = %q", failures.err.Reasons[0])
+	}
+}
+
+func TestImportDocumentsChecksResultCount(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		fmt.Fprintln(w, `{"success": true}`)
+	}))
+
+	defer srv.Close()
+
+	s := &Service{host: srv.URL}
+
+	if _, err := s.importDocuments(context.Background(), DbPostsToDocuments(testPosts(1, 2)), "post_a"); err == nil {
+		t.Error("importDocuments() accepted a single result for two documents")
+	}
+}
+
+func TestUpsertRetriesFailedDocuments(t *testing.T) {
+	s, is := newImportServer(t, func(id string, attempt int) bool {
+		return id == "2" && attempt == 0
+	})
+
+	if err := s.Upsert(context.Background(), testPosts(1, 2, 3), "post_a", time.Time{}); err != nil {
+		t.Fatalf("Upsert() failed: %s", err)
+	}
+
+	if fmt.Sprint(is.imports) != "[[1 2 3] [2]]" {
+		t.Errorf("Imported %v, want [[1 2 3] [2]]", is.imports)
+	}
+}
+
+func TestUpsertRejectsDocumentsFailingEveryTime(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Waits between retries")
+	}
+
+	s, is := newImportServer(t, func(id string, attempt int) bool {
+		return id == "3"
+	})
+
+	err := s.Upsert(context.Background(), testPosts(1, 2, 3), "post_a", time.Time{})
+
+	var importErr *ImportError
+
+	if !errors.Is(err, sink.ErrRejected) || !errors.As(err, &importErr) || importErr.Failed != 1 {
+		t.Errorf("Upsert() = %v, want post 3 rejected", err)
+	}
+
+	if len(is.imports) != 3 {
+		t.Errorf("Imported %d times, want 3", len(is.imports))
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"moon/config"
+	"moon/db"
+	"moon/indexer"
+	"os"
+	"text/tabwriter"
+
+	"github.com/uptrace/bun"
+)
+
+//verify compares the live index of a board in every sink with
+//the database and prints the ranges of post numbers that differ,
+//repairing them if asked to. Moon is best stopped before repairing,
+//as passes in progress could commit posts half indexed.
+func verify(ctx context.Context, conf config.Config, pg *bun.DB, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	rangeSize := fs.Int64("range", 10000, "How many post numbers to compare at once")
+	repair := fs.Bool("repair", false, "Upsert missing posts again and delete extra ones")
+	sinkName := fs.String("sink", "", "Only verify the index of this sink")
+
+	positional, err := parseArgs(fs, args)
+
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 1 || *rangeSize <= 0 {
+		return fmt.Errorf("Usage: moon verify <board> [--range n] [--repair] [--sink s]")
+	}
+
+	boardConf, err := boardConfig(conf, positional[0])
+
+	if err != nil {
+		return err
+	}
+
+	conf.Boards = []config.BoardConfig{boardConf}
+
+	if *sinkName != "" {
+		conf.SyncConfig.Sinks = []string{*sinkName}
+	}
+
+	if err := db.Migrate(ctx, pg); err != nil {
+		return err
+	}
+
+	sinks, err := newSinks(ctx, conf)
+
+	if err != nil {
+		return err
+	}
+
+	discrepancies, err := indexer.NewIndexer(conf, pg, sinks).Verify(ctx, boardConf.Name, *rangeSize, *repair)
+
+	if closeErr := closeSinks(sinks); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SINK\tINDEX\tFROM\tTO\tEXPECTED\tFOUND\tMISSING\tEXTRA\tDUPLICATED\tREPAIRED")
+
+	for _, d := range discrepancies {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%t\n", d.Sink, d.Index, d.From, d.To, d.Expected, d.Found, len(d.Missing), len(d.Extra), len(d.Duplicated), d.Repaired)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(discrepancies) > 0 && !*repair {
+		return fmt.Errorf("%d ranges of board %s differ from the database", len(discrepancies), boardConf.Name)
+	}
+
+	return nil
+}